@@ -2,25 +2,188 @@ package korm
 
 import (
 	"database/sql"
+	"fmt"
+	"sync"
+)
+
+const (
+	EventQueryBefore  = "query_before"
+	EventQueryAfter   = "query_after"
+	EventInsertBefore = "insert_before"
+	EventInsertAfter  = "insert_after"
+	EventUpdateBefore = "update_before"
+	EventUpdateAfter  = "update_after"
+	EventDeleteBefore = "delete_before"
+	EventDeleteAfter  = "delete_after"
+	EventExecBefore   = "exec_before" // Context.Query/Exec原生语句
+	EventExecAfter    = "exec_after"
 )
 
 type CallbackParams struct {
 	Action string
+	Context *Context
 	Model *Model
 	MapRows []map[string]interface{}
 	Map map[string]interface{}
 	Rows *sql.Rows
+	Sql string
+	Args []interface{}
 }
 
 type EventCallback func(params *CallbackParams) error
 
+type callback struct {
+	name string
+	fn   EventCallback
+}
+
+// 连接级回调注册表, 在启动时注册一次即可对所有Context生效
+type Callbacks struct {
+	lock   sync.RWMutex
+	events map[string][]*callback
+}
+
+// 回调注册器, 用于指定回调的顺序
+type CallbackRegister struct {
+	callbacks *Callbacks
+	event     string
+	before    string
+	after     string
+}
+
+func newCallbacks() *Callbacks {
+	c := &Callbacks{}
+	c.events = make(map[string][]*callback)
+	return c
+}
+
+// 指定事件
+func (c *Callbacks) On(event string) *CallbackRegister {
+	return &CallbackRegister{callbacks: c, event: event}
+}
+
+// 调用指定事件
+func (c *Callbacks) emit(event string, params *CallbackParams) error {
+	c.lock.RLock()
+	list := c.events[event]
+	c.lock.RUnlock()
+	for _, cb := range list {
+		if err := cb.fn(params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 事件已注册的回调名称
+func (c *Callbacks) Names(event string) []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	names := make([]string, 0, len(c.events[event]))
+	for _, cb := range c.events[event] {
+		names = append(names, cb.name)
+	}
+	return names
+}
+
+// 注册在指定回调之前, *表示最前
+func (r *CallbackRegister) Before(name string) *CallbackRegister {
+	r.before = name
+	return r
+}
+
+// 注册在指定回调之后, *表示最后
+func (r *CallbackRegister) After(name string) *CallbackRegister {
+	r.after = name
+	return r
+}
+
+// 注册回调, 名称在同一事件内需唯一
+func (r *CallbackRegister) Register(name string, fn EventCallback) error {
+	c := r.callbacks
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	list := c.events[r.event]
+	if indexOfCallback(list, name) >= 0 {
+		return fmt.Errorf("callback %s already registered on %s", name, r.event)
+	}
+
+	pos := len(list)
+	if r.before == "*" {
+		pos = 0
+	} else if i := indexOfCallback(list, r.before); i >= 0 {
+		pos = i
+	} else if i := indexOfCallback(list, r.after); i >= 0 {
+		pos = i + 1
+	}
+
+	newList := make([]*callback, 0, len(list)+1)
+	newList = append(newList, list[:pos]...)
+	newList = append(newList, &callback{name: name, fn: fn})
+	newList = append(newList, list[pos:]...)
+	c.events[r.event] = newList
+	return nil
+}
+
+// 移除回调
+func (r *CallbackRegister) Remove(name string) {
+	c := r.callbacks
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	list := c.events[r.event]
+	if i := indexOfCallback(list, name); i >= 0 {
+		newList := make([]*callback, 0, len(list)-1)
+		newList = append(newList, list[:i]...)
+		c.events[r.event] = append(newList, list[i+1:]...)
+	}
+}
+
+// 替换回调, 保持原有顺序
+func (r *CallbackRegister) Replace(name string, fn EventCallback) error {
+	c := r.callbacks
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	list := c.events[r.event]
+	i := indexOfCallback(list, name)
+	if i < 0 {
+		return fmt.Errorf("callback %s not registered on %s", name, r.event)
+	}
+	newList := make([]*callback, len(list))
+	copy(newList, list)
+	newList[i] = &callback{name: name, fn: fn}
+	c.events[r.event] = newList
+	return nil
+}
+
+func indexOfCallback(list []*callback, name string) int {
+	if name == "" {
+		return -1
+	}
+	for i, cb := range list {
+		if cb.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// 注册内置回调到ctx使用的连接回调注册表, 已注册时不会重复注册
+// Deprecated: 内置回调在创建连接时已自动注册, 保留此函数兼容旧代码
 func RegisterCallback(ctx *Context)  {
+	if mainConnect != nil && mainConnect.callbacks != nil {
+		registerDefaultCallbacks(mainConnect.callbacks)
+	}
+}
+
+// 注册内置回调, 同名回调已存在时跳过
+func registerDefaultCallbacks(callbacks *Callbacks)  {
 	// region ----查询后事件----
-	ctx.OnEventQueryAfter(func(params *CallbackParams) error {
+	_ = callbacks.On(EventQueryAfter).Register("korm:relation_item", func(params *CallbackParams) error {
 		if params.Action == "select" {
-			for i := 0; i < params.Model.schema.Data.Len(); i++ {
-				_ = params.Model.schema.Data.Index(i).FieldByName(params.Model.schema.PrimaryKey)
-				if err := params.Model.loadRelationDataItem(i, params.MapRows[i]); err != nil {
+			// Data中可能已有之前查询的数据, 本次数据位于末尾
+			offset := params.Model.schema.Data.Len() - len(params.MapRows)
+			for i := range params.MapRows {
+				if err := params.Model.loadRelationDataItem(offset+i, params.MapRows[i]); err != nil {
 					return err
 				}
 
@@ -33,28 +196,32 @@ func RegisterCallback(ctx *Context)  {
 		return nil
 	})
 
-	ctx.OnEventQueryAfter(func(params *CallbackParams) error {
+	_ = callbacks.On(EventQueryAfter).Register("korm:relation_fetch", func(params *CallbackParams) error {
 		return params.Model.fetchRelationDbData()
 	})
 	// endregion
 
 	// region ----插入后事件----
-	ctx.OnInsertAfterCallback(func(params *CallbackParams) error {
+	_ = callbacks.On(EventInsertAfter).Register("korm:relation_insert", func(params *CallbackParams) error {
 		return params.Model.insertRelationData()
 	})
 	// endregion
 
 	// region ----更新后事件----
-	ctx.OnUpdateAfterCallback(func(params *CallbackParams) error {
+	_ = callbacks.On(EventUpdateAfter).Register("korm:relation_update", func(params *CallbackParams) error {
 		return params.Model.updateRelationData()
 	})
 	// endregion
 
 	// region ----删除后事件----
-	ctx.OnDeleteAfterCallback(func(params *CallbackParams) error {
+	_ = callbacks.On(EventDeleteAfter).Register("korm:relation_delete", func(params *CallbackParams) error {
+		// 按主键列表删除时模型中没有被删除的数据, 不级联
+		if params.Action != "delete" {
+			return nil
+		}
 		return params.Model.deleteRelationData()
 	})
 	// endregion
-	
+
 
 }
@@ -0,0 +1,46 @@
+package korm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// 测试回调注册顺序
+func TestCallbacksOrder(t *testing.T) {
+	cb := newCallbacks()
+	calls := make([]string, 0)
+	fn := func(name string) EventCallback {
+		return func(params *CallbackParams) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+	assert.NoError(t, cb.On(EventQueryBefore).Register("a", fn("a")))
+	assert.NoError(t, cb.On(EventQueryBefore).Register("b", fn("b")))
+	assert.NoError(t, cb.On(EventQueryBefore).Before("b").Register("c", fn("c")))
+	assert.NoError(t, cb.On(EventQueryBefore).After("b").Register("d", fn("d")))
+	assert.NoError(t, cb.On(EventQueryBefore).Before("*").Register("e", fn("e")))
+	assert.Error(t, cb.On(EventQueryBefore).Register("a", fn("a")))
+	assert.Equal(t, []string{"e", "a", "c", "b", "d"}, cb.Names(EventQueryBefore))
+
+	cb.On(EventQueryBefore).Remove("c")
+	assert.NoError(t, cb.On(EventQueryBefore).Replace("a", fn("a2")))
+	assert.Error(t, cb.On(EventQueryBefore).Replace("x", fn("x")))
+	assert.NoError(t, cb.emit(EventQueryBefore, &CallbackParams{}))
+	assert.Equal(t, []string{"e", "a2", "b", "d"}, calls)
+}
+
+// 测试内置回调
+func TestDefaultCallbacks(t *testing.T) {
+	cb := newCallbacks()
+	registerDefaultCallbacks(cb)
+	registerDefaultCallbacks(cb)
+	assert.Equal(t, []string{"korm:relation_item", "korm:relation_fetch"}, cb.Names(EventQueryAfter))
+	assert.Equal(t, []string{"korm:relation_delete"}, cb.Names(EventDeleteAfter))
+}
+
+// 测试旧的注册函数不会重复注册内置回调
+func TestRegisterCallbackCompat(t *testing.T) {
+	RegisterCallback(NewContext())
+	assert.Equal(t, []string{"korm:relation_item", "korm:relation_fetch"}, mainConnect.callbacks.Names(EventQueryAfter))
+}
@@ -6,6 +6,10 @@ type Config struct {
 	MaxIdleConns int // 最大空闲连接数
 	ConnMaxLifetime int // 保持连接时间
 	PrintSql bool
+	PingTimeout int // 连接检查超时时间(秒), 默认5
+	FailoverThreshold int // 连续检查失败多少次后切换到备用库, 默认3
+	FailoverGrace int // 切换后旧连接池等待进行中的语句结束的最长时间(秒), 默认30
+	Metrics MetricsSink // 指标收集, 为空时仅记录到Stats
 }
 
 type DbConfig struct {
@@ -17,4 +21,36 @@ type DbConfig struct {
 	Port int
 	Database string
 	TablePrefix string
+	Dsn string // 直接指定dsn, 填写后忽略Host等连接项
+	Replicas []DbConfig // 只读从库, 未填写的项沿用主库配置
+	Failover *DbConfig // 备用库, 主库持续不可用时切换, 需与主库为同类型数据库
+	ReplicaPolicy string // 从库选择方式: round_robin(默认), least_conn
+}
+
+const (
+	ReplicaRoundRobin = "round_robin" // 轮询
+	ReplicaLeastConn  = "least_conn"  // 使用中连接最少
+)
+
+// 从库配置, 未填写的项沿用主库
+func (c *DbConfig) replicaConfig(replica DbConfig) *DbConfig {
+	if replica.Driver == "" {
+		replica.Driver = c.Driver
+	}
+	if replica.Host == "" {
+		replica.Host = c.Host
+	}
+	if replica.Port == 0 {
+		replica.Port = c.Port
+	}
+	if replica.User == "" {
+		replica.User = c.User
+	}
+	if replica.Pass == "" {
+		replica.Pass = c.Pass
+	}
+	if replica.Database == "" {
+		replica.Database = c.Database
+	}
+	return &replica
 }
@@ -11,10 +11,14 @@ var (
 type Connect struct {
 	config Config
 	dbList map[string]*kdb
+	callbacks *Callbacks
 }
 
 // 讲dbConfig转为dsn字符
 func configToDsn(config *DbConfig) string {
+	if config.Dsn != "" {
+		return config.Dsn
+	}
 	switch config.Driver {
 	case "mysql":
 		return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", config.User, config.Pass, config.Host, config.Port, config.Database)
@@ -32,9 +36,16 @@ func NewConnect(config Config) *Connect {
 		mainConnect.config.DefaultConn = "default"
 	}
 	mainConnect.dbList = make(map[string]*kdb)
+	mainConnect.callbacks = newCallbacks()
+	registerDefaultCallbacks(mainConnect.callbacks)
 	return mainConnect
 }
 
+// 连接级回调注册表
+func (c *Connect) Callbacks() *Callbacks {
+	return c.callbacks
+}
+
 // 添加数据库连接
 func (c *Connect) AddDb(config DbConfig) error {
 	if config.Conn == "" {
@@ -51,6 +62,6 @@ func (c *Connect) AddDb(config DbConfig) error {
 // 关闭所有连接
 func (c *Connect) Close() {
 	for _, db := range c.dbList {
-		_ = db.db.Close()
+		db.close()
 	}
 }
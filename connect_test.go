@@ -0,0 +1,63 @@
+package korm
+
+import (
+	"database/sql/driver"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type TestConnOrder struct {
+	Id    int64          `db:"id"`
+	Items []TestConnItem `pk:"Id" fk:"OrderId"`
+}
+
+type TestConnItem struct {
+	Id      int64 `db:"id"`
+	OrderId int64 `db:"order_id"`
+}
+
+func (TestConnItem) Conn() string {
+	return "conn_item"
+}
+
+func (TestConnOrder) Conn() string {
+	return "conn_order"
+}
+
+// 测试按模型声明的连接路由
+func TestModelConn(t *testing.T) {
+	items := setFakeTable("conn_item", []string{"id", "order_id"}, [][]driver.Value{{int64(5), int64(1)}})
+	newFakeModel("conn_item", &TestConnItem{})
+	orders := setFakeTable("conn_order", []string{"id"}, [][]driver.Value{{int64(1)}})
+
+	assert.Equal(t, mainConnect.dbList["conn_item"], NewContext().Model(&TestConnItem{}).db)
+
+	var rows []TestConnOrder
+	newFakeModel("conn_order", &rows)
+	m := NewContext().Model(&rows)
+	assert.Equal(t, mainConnect.dbList["conn_order"], m.db)
+	assert.Equal(t, m.db, UseContext("conn_order").Model(&TestConnItem{}).db)
+	assert.NoError(t, m.With("Items").Select().Error)
+	assert.Len(t, orders.queries, 1)
+	assert.Equal(t, []string{"SELECT `id`,`order_id` FROM `test_conn_item` WHERE `order_id` in(?)"}, items.queries)
+	assert.Equal(t, int64(5), rows[0].Items[0].Id)
+
+	// Use指定的连接同样用于关联加载
+	assert.NoError(t, UseContext("conn_order").Model(&rows).With("Items").Select().Error)
+	assert.Len(t, items.queries, 1)
+	assert.Equal(t, "SELECT `id`,`order_id` FROM `test_conn_item` WHERE `order_id` in(?)", orders.queries[2])
+}
+
+// 测试未注册的连接返回错误
+func TestModelConnMissing(t *testing.T) {
+	var rows []TestConnOrder
+	ctx := UseContext("conn_missing")
+	assert.EqualError(t, ctx.Model(&rows).Where("Id", 1).Select().Error, "connection conn_missing not found")
+	_, err := ctx.Model(&rows).Count()
+	assert.EqualError(t, err, "connection conn_missing not found")
+	var sum int64
+	assert.Error(t, ctx.Model(&rows).Sum("Id", &sum))
+	assert.Error(t, ctx.Model(&TestConnOrder{Id: 1}).Update())
+	assert.Error(t, ctx.Model(&TestConnOrder{}).FirstOrCreate(map[string]interface{}{"Id": 1}).Error)
+	assert.EqualError(t, ctx.Transaction(func() error { return nil }), "connection conn_missing not found")
+}
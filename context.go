@@ -4,11 +4,14 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/wdaglb/korm/schema"
+	"time"
 )
 
 type Context struct {
 	conn string
 	events map[string][]EventCallback
+	tenant interface{} // 当前租户id
+	ignoreTenant bool // 忽略租户隔离
 }
 
 type TransactionCall func() error
@@ -16,7 +19,6 @@ type TransactionCall func() error
 func NewContext() *Context {
 	ctx := &Context{}
 	ctx.events = make(map[string][]EventCallback)
-	RegisterCallback(ctx)
 	return ctx
 }
 
@@ -41,36 +43,58 @@ func (ctx *Context) Db() *kdb {
 	return mainConnect.dbList[ctx.conn]
 }
 
+// 模型使用的连接, 优先使用Use指定的连接, 其次为模型声明的连接, 最后为默认连接
+func (ctx *Context) modelDb(conn string) *kdb {
+	return mainConnect.dbList[ctx.modelConn(conn)]
+}
+
+// 模型实际使用的连接名
+func (ctx *Context) modelConn(conn string) string {
+	if ctx.conn != "" {
+		return ctx.conn
+	}
+	if conn != "" {
+		return conn
+	}
+	return mainConnect.config.DefaultConn
+}
+
 // 监听查询后事件
 func (ctx *Context) OnEventQueryAfter(callback EventCallback) *Context {
-	event := "query_after"
+	event := EventQueryAfter
 	ctx.events[event] = append(ctx.events[event], callback)
 	return ctx
 }
 
 // 监听插入后事件
 func (ctx *Context) OnInsertAfterCallback(callback EventCallback) *Context {
-	event := "insert_after"
+	event := EventInsertAfter
 	ctx.events[event] = append(ctx.events[event], callback)
 	return ctx
 }
 
 // 监听更新后事件
 func (ctx *Context) OnUpdateAfterCallback(callback EventCallback) *Context {
-	event := "update_after"
+	event := EventUpdateAfter
 	ctx.events[event] = append(ctx.events[event], callback)
 	return ctx
 }
 
 // 监听删除后事件
 func (ctx *Context) OnDeleteAfterCallback(callback EventCallback) *Context {
-	event := "delete_after"
+	event := EventDeleteAfter
 	ctx.events[event] = append(ctx.events[event], callback)
 	return ctx
 }
 
-// 调用指定事件
+// 调用指定事件, 先调用连接级回调, 再调用当前Context的回调
 func (ctx *Context) emitEvent(event string, params *CallbackParams) (err error) {
+	params.Context = ctx
+	if mainConnect != nil && mainConnect.callbacks != nil {
+		if err = mainConnect.callbacks.emit(event, params); err != nil {
+			return
+		}
+	}
 	for _, fun := range ctx.events[event] {
 		err = fun(params)
 		if err != nil {
@@ -81,7 +105,11 @@ func (ctx *Context) emitEvent(event string, params *CallbackParams) (err error)
 }
 
 // 事务处理
+// 事务只在当前Context的连接上开启, 声明了其它连接(Conn)的模型不在该事务中
 func (ctx *Context) Transaction(call TransactionCall) error {
+	if ctx.Db() == nil {
+		return fmt.Errorf("connection %s not found", ctx.modelConn(""))
+	}
 	key, err := ctx.Db().Begin()
 	if err != nil {
 		return fmt.Errorf("transaction enable fail: %v", err)
@@ -109,11 +137,24 @@ func (ctx *Context) Transaction(call TransactionCall) error {
 
 // 新的模型实例
 func (ctx *Context) Model(mod interface{}) *Model {
+	sch := schema.NewSchema(mod)
+	if db := ctx.modelDb(sch.Conn); db != nil {
+		return newModel(ctx, mod, sch, db)
+	}
+	// 连接未注册时使用空连接占位, 执行方法返回错误
+	conn := ctx.modelConn(sch.Conn)
+	model := newModel(ctx, mod, sch, &kdb{config: &Config{}, dbConf: &DbConfig{Conn: conn}})
+	model.err = fmt.Errorf("connection %s not found", conn)
+	return model
+}
+
+// 使用已解析的结构创建模型
+func newModel(ctx *Context, mod interface{}, sch *schema.Schema, db *kdb) *Model {
 	model := &Model{}
 	model.context = ctx
-	model.db = ctx.Db()
 	model.model = mod
-	model.schema = schema.NewSchema(mod)
+	model.schema = sch
+	model.db = db
 	model.withList = make(map[string]WithCond)
 	if len(model.schema.WithList) > 0 {
 		for _, n := range model.schema.WithList {
@@ -127,39 +168,63 @@ func (ctx *Context) Model(mod interface{}) *Model {
 }
 
 // query
-func (ctx *Context) Query(sqlStr string, params ...interface{}) (*sql.Rows, error) {
-	var (
-		err error
-		stmt *sql.Stmt
-	)
+func (ctx *Context) Query(sqlStr string, params ...interface{}) (rows *sql.Rows, err error) {
+	var stmt *sql.Stmt
 	db := ctx.Db()
+	if db == nil {
+		return nil, fmt.Errorf("connection %s not found", ctx.modelConn(""))
+	}
+	callbackParams := &CallbackParams{Action: "query", Sql: sqlStr, Args: params}
+	if err = ctx.emitEvent(EventExecBefore, callbackParams); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	defer func() {
+		db.observeQuery("query", start, err)
+	}()
 	stmt, err = db.Prepare(sqlStr)
 	if err != nil {
 		return nil, fmt.Errorf("prepare fail: %v", err)
 	}
 	defer stmt.Close()
-	rows, err := stmt.Query(params...)
+	rows, err = stmt.Query(params...)
 	if err != nil {
 		return nil, fmt.Errorf("query fail: %v", err)
 	}
+	callbackParams.Rows = rows
+	if err = ctx.emitEvent(EventExecAfter, callbackParams); err != nil {
+		_ = rows.Close()
+		return nil, err
+	}
 	return rows, nil
 }
 
 // exec
-func (ctx *Context) Exec(sqlStr string, params ...interface{}) (sql.Result, error) {
-	var (
-		err error
-		stmt *sql.Stmt
-	)
+func (ctx *Context) Exec(sqlStr string, params ...interface{}) (result sql.Result, err error) {
+	var stmt *sql.Stmt
 	db := ctx.Db()
+	if db == nil {
+		return nil, fmt.Errorf("connection %s not found", ctx.modelConn(""))
+	}
+	callbackParams := &CallbackParams{Action: "exec", Sql: sqlStr, Args: params}
+	if err = ctx.emitEvent(EventExecBefore, callbackParams); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	defer func() {
+		db.observeQuery("exec", start, err)
+	}()
 	stmt, err = db.Prepare(sqlStr)
 	if err != nil {
 		return nil, fmt.Errorf("prepare fail: %v", err)
 	}
 	defer stmt.Close()
-	rows, err := stmt.Exec(params...)
+	result, err = stmt.Exec(params...)
 	if err != nil {
 		return nil, fmt.Errorf("exec fail: %v", err)
 	}
-	return rows, nil
+	if err = ctx.emitEvent(EventExecAfter, callbackParams); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
@@ -29,6 +29,8 @@ type TestCate struct {
 	TestId int64 `db:"test_id"`
 }
 
+var testDbReady bool
+
 func init()  {
 	_ = godotenv.Load(".env")
 	val, _ := strconv.Atoi(os.Getenv("DB_PORT"))
@@ -45,12 +47,21 @@ func init()  {
 	})
 	if err != nil {
 		fmt.Println(err)
-		os.Exit(0)
+		return
+	}
+	testDbReady = true
+}
+
+// 未配置测试数据库时跳过
+func requireDb(t *testing.T) {
+	if !testDbReady {
+		t.Skip("test database is not configured")
 	}
 }
 
 // 测试统计查询
 func TestCount(t *testing.T)  {
+	requireDb(t)
 	ctx := NewContext()
 	count, err := ctx.Model(Test{}).Count()
 
@@ -59,6 +70,7 @@ func TestCount(t *testing.T)  {
 
 // 测试求和查询
 func TestSum(t *testing.T)  {
+	requireDb(t)
 	ctx := NewContext()
 	dst := 0
 	_ = ctx.Model(Test{}).Sum("Id", &dst)
@@ -68,6 +80,7 @@ func TestSum(t *testing.T)  {
 
 // 测试最大值查询
 func TestMax(t *testing.T)  {
+	requireDb(t)
 	ctx := NewContext()
 	dst := 0
 	_ = ctx.Model(Test{}).Max("Id", &dst)
@@ -77,6 +90,7 @@ func TestMax(t *testing.T)  {
 
 // 测试最小值查询
 func TestMin(t *testing.T)  {
+	requireDb(t)
 	ctx := NewContext()
 	dst := 0
 	_ = ctx.Model(Test{}).Min("Id", &dst)
@@ -86,6 +100,7 @@ func TestMin(t *testing.T)  {
 
 // 测试平均值查询
 func TestAvg(t *testing.T)  {
+	requireDb(t)
 	ctx := NewContext()
 	var dst float64
 	_ = ctx.Model(Test{}).Avg("Id", &dst)
@@ -95,6 +110,7 @@ func TestAvg(t *testing.T)  {
 
 // 测试数据创建
 func TestCreate(t *testing.T)  {
+	requireDb(t)
 	ctx := NewContext()
 
 	cates := make([]TestCate, 0)
@@ -124,6 +140,7 @@ func TestCreate(t *testing.T)  {
 
 // 测试数据更新
 func TestUpdate(t *testing.T)  {
+	requireDb(t)
 	ctx := NewContext()
 	row := &Test{}
 
@@ -144,6 +161,7 @@ func TestUpdate(t *testing.T)  {
 
 // 测试多行查询
 func TestSelect(t *testing.T)  {
+	requireDb(t)
 	ctx := NewContext()
 	var rows []Test
 	// Where("Id", "in", []int{1, 2, 3, 4}).
@@ -161,6 +179,7 @@ func TestSelect(t *testing.T)  {
 
 // 测试单行查询
 func TestFind(t *testing.T)  {
+	requireDb(t)
 	ctx := NewContext()
 
 	row := &Test{}
@@ -183,6 +202,7 @@ func TestFind(t *testing.T)  {
 
 // 测试数据删除
 func TestDelete(t *testing.T)  {
+	requireDb(t)
 	ctx := NewContext()
 	row := &Test{}
 
@@ -0,0 +1,134 @@
+package korm
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/wdaglb/korm/schema"
+	"reflect"
+	"time"
+)
+
+// 游标, 逐行读取查询结果, 不在内存中保留全部数据
+type Cursor struct {
+	model   *Model
+	stmt    *sql.Stmt
+	rows    *sql.Rows
+	scanner *schema.RowScanner
+	err     error
+}
+
+// 执行当前查询并返回游标, 使用完毕需调用Close
+func (m *Model) Cursor() (*Cursor, error) {
+	m = m.instance()
+	stmt, rows, err := m.queryRows("cursor")
+	if err != nil {
+		return nil, err
+	}
+	scanner, err := m.newRowScanner(rows)
+	if err != nil {
+		_ = rows.Close()
+		_ = stmt.Close()
+		return nil, fmt.Errorf("query fail: %v", err)
+	}
+	return &Cursor{model: m, stmt: stmt, rows: rows, scanner: scanner}, nil
+}
+
+// 执行当前查询并返回原始结果集, 可配合ScanRow读取到结构
+func (m *Model) Rows() (*sql.Rows, error) {
+	m = m.instance()
+	stmt, rows, err := m.queryRows("rows")
+	if err != nil {
+		return nil, err
+	}
+	// 预处理语句在结果集关闭后才会真正释放
+	_ = stmt.Close()
+	return rows, nil
+}
+
+// 将结果集当前行扫描到dst结构指针
+func (m *Model) ScanRow(rows *sql.Rows, dst interface{}) error {
+	scanner, err := m.newRowScanner(rows)
+	if err != nil {
+		return fmt.Errorf("query fail: %v", err)
+	}
+	if err = m.scanRow(scanner, rows, dst); err != nil {
+		return err
+	}
+	m.db.observeRows("rows", 1)
+	return nil
+}
+
+// 扫描一行到dst并调用查询后钩子
+func (m *Model) scanRow(scanner *schema.RowScanner, rows *sql.Rows, dst interface{}) error {
+	value := reflect.ValueOf(dst)
+	if value.Kind() != reflect.Ptr || value.Elem().Type() != m.schema.Type {
+		return fmt.Errorf("scan dst must be *%s", m.schema.Type.Name())
+	}
+	if _, err := scanner.Scan(rows, value.Elem()); err != nil {
+		return fmt.Errorf("scan fail: %v", err)
+	}
+	return m.callRowHook(hookAfterFind, value.Elem())
+}
+
+// 执行查询语句, 调用方负责关闭语句及结果集
+func (m *Model) queryRows(action string) (stmt *sql.Stmt, rows *sql.Rows, err error) {
+	if m.schema.TableName == "" {
+		return nil, nil, errors.New("table is not set")
+	}
+	if err = m.emitBefore(EventQueryBefore, action); err != nil {
+		return nil, nil, err
+	}
+	m.builder.p = "select"
+	sqlStr, bindParams := m.builder.ToString()
+	start := time.Now()
+	defer func() {
+		m.db.observeQuery(action, start, err)
+	}()
+
+	stmt, err = m.db.prepareRead(sqlStr, m.usePrimary)
+	if err != nil {
+		return nil, nil, fmt.Errorf("prepare fail: %v", err)
+	}
+	rows, err = stmt.Query(bindParams...)
+	if err != nil {
+		_ = stmt.Close()
+		return nil, nil, fmt.Errorf("query fail: %v", err)
+	}
+	return stmt, rows, nil
+}
+
+// 是否还有下一行
+func (c *Cursor) Next() bool {
+	if c.err != nil {
+		return false
+	}
+	return c.rows.Next()
+}
+
+// 将当前行扫描到dst结构指针
+func (c *Cursor) Scan(dst interface{}) error {
+	if err := c.model.scanRow(c.scanner, c.rows, dst); err != nil {
+		c.err = err
+		return err
+	}
+	c.model.db.observeRows("cursor", 1)
+	return nil
+}
+
+// 遍历中的错误
+func (c *Cursor) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.rows.Err()
+}
+
+// 关闭游标
+func (c *Cursor) Close() error {
+	err := c.rows.Close()
+	if e := c.stmt.Close(); err == nil {
+		err = e
+	}
+	return err
+}
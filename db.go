@@ -4,22 +4,60 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type kdb struct {
+	lock sync.RWMutex
 	db *sql.DB
+	replicas []*sql.DB // 只读从库
+	replicaNext uint32 // 轮询位置
 	config *Config
 	dbConf *DbConfig
 	currentKey *Queue
 	txCount int
 	tx map[int]*sql.Tx
+	health HealthStatus // 最近一次检查结果
+	stats queryStats
 }
 
 func NewDb(config *Config, dbConf *DbConfig) (*kdb, error) {
-	var (
-		db *sql.DB
-	)
+	db, err := openDb(config, dbConf)
+	if err != nil {
+		return nil, err
+	}
+	kdb := &kdb{}
+	kdb.db = db
+	kdb.config = config
+	kdb.dbConf = dbConf
+	kdb.currentKey = newQueue()
+	kdb.tx = make(map[int]*sql.Tx)
+	kdb.health.Conn = dbConf.Conn
+	if err = kdb.startupPing(); err != nil {
+		kdb.close()
+		return nil, err
+	}
+	for _, replica := range dbConf.Replicas {
+		rdb, err := openDb(config, dbConf.replicaConfig(replica))
+		if err != nil {
+			kdb.close()
+			return nil, fmt.Errorf("replica %s fail: %v", replica.Host, err)
+		}
+		kdb.replicas = append(kdb.replicas, rdb)
+		kdb.health.Replicas = append(kdb.health.Replicas, HealthStatus{
+			Conn:    fmt.Sprintf("%s/replica%d", dbConf.Conn, len(kdb.replicas)-1),
+			Healthy: true,
+		})
+	}
+	// 启动时检查从库, 不可用的从库不参与读操作, 直到后续检查恢复
+	kdb.checkReplicas()
+	return kdb, nil
+}
+
+// 按配置打开连接池
+func openDb(config *Config, dbConf *DbConfig) (*sql.DB, error) {
 	dsn := configToDsn(dbConf)
 	if dsn == "" {
 		return nil, fmt.Errorf("unsupported driver: %s", dbConf.Driver)
@@ -37,13 +75,65 @@ func NewDb(config *Config, dbConf *DbConfig) (*kdb, error) {
 	db.SetMaxOpenConns(config.MaxOpenConns)
 	db.SetMaxIdleConns(config.MaxIdleConns)
 	db.SetConnMaxLifetime(time.Duration(config.ConnMaxLifetime) * time.Second)
-	kdb := &kdb{}
-	kdb.db = db
-	kdb.config = config
-	kdb.dbConf = dbConf
-	kdb.currentKey = newQueue()
-	kdb.tx = make(map[int]*sql.Tx)
-	return kdb, nil
+	return db, nil
+}
+
+// 关闭主库及从库连接
+func (t *kdb) close() {
+	if db := t.primary(); db != nil {
+		_ = db.Close()
+	}
+	for _, db := range t.replicas {
+		_ = db.Close()
+	}
+}
+
+// 选择读操作使用的从库, 没有从库时返回主库
+func (t *kdb) reader() *sql.DB {
+	replicas := t.healthyReplicas()
+	switch len(replicas) {
+	case 0:
+		return t.primary()
+	case 1:
+		return replicas[0]
+	}
+	if t.dbConf.ReplicaPolicy == ReplicaLeastConn {
+		db := replicas[0]
+		inUse := db.Stats().InUse
+		for _, replica := range replicas[1:] {
+			if n := replica.Stats().InUse; n < inUse {
+				db, inUse = replica, n
+			}
+		}
+		return db
+	}
+	n := atomic.AddUint32(&t.replicaNext, 1)
+	return replicas[(n-1)%uint32(len(replicas))]
+}
+
+// 最近一次检查可用的从库, 未检查过的从库视为可用
+func (t *kdb) healthyReplicas() []*sql.DB {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	list := make([]*sql.DB, 0, len(t.replicas))
+	for i, db := range t.replicas {
+		if i < len(t.health.Replicas) && !t.health.Replicas[i].Healthy {
+			continue
+		}
+		list = append(list, db)
+	}
+	return list
+}
+
+// 预处理读语句, 事务中或指定主库时使用主库
+func (t *kdb) prepareRead(query string, primary bool) (*sql.Stmt, error) {
+	if c := t.current(); c != nil {
+		return c.Prepare(query)
+	}
+	if primary {
+		return t.primary().Prepare(query)
+	}
+	return t.reader().Prepare(query)
 }
 
 // 申请空闲事务标识
@@ -63,13 +153,14 @@ func (t *kdb) Begin() (int, error) {
 		err error
 		tx *sql.Tx
 	)
-	tx, err = t.db.Begin()
+	tx, err = t.primary().Begin()
 	if err != nil {
 		return 0, err
 	}
 	k := t.getKey()
 	t.currentKey.push(k)
 	t.tx[k] = tx
+	t.observeTxBegin(k)
 	return k, nil
 }
 
@@ -85,7 +176,9 @@ func (t *kdb) Commit(key int) error {
 		}
 		t.tx[key] = nil
 	}()
-	return t.tx[key].Commit()
+	err := t.tx[key].Commit()
+	t.observeTxEnd(key, err == nil)
+	return err
 }
 
 // Rollback 回滚标识对应的事务
@@ -99,7 +192,9 @@ func (t *kdb) Rollback(key int) error {
 		}
 		t.tx[key] = nil
 	}()
-	return t.tx[key].Rollback()
+	err := t.tx[key].Rollback()
+	t.observeTxEnd(key, false)
+	return err
 }
 
 // 当前操作事务
@@ -114,61 +209,61 @@ func (t *kdb) current() *sql.Tx {
 
 // Handler 获取db实例
 func (t *kdb) Handler() *sql.DB {
-	return t.db
+	return t.primary()
 }
 
 func (t *kdb) Exec(query string, args ...interface{}) (sql.Result, error) {
 	if c := t.current(); c != nil {
 		return c.Exec(query, args...)
 	}
-	return t.db.Exec(query, args...)
+	return t.primary().Exec(query, args...)
 }
 
 func (t *kdb) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
 	if c := t.current(); c != nil {
 		return c.ExecContext(ctx, query, args)
 	}
-	return t.db.ExecContext(ctx, query, args)
+	return t.primary().ExecContext(ctx, query, args)
 }
 
 func (t *kdb) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
 	if c := t.current(); c != nil {
 		return c.QueryContext(ctx, query, args...)
 	}
-	return t.db.QueryContext(ctx, query, args...)
+	return t.primary().QueryContext(ctx, query, args...)
 }
 
 func (t *kdb) Query(query string, args ...interface{}) (*sql.Rows, error) {
 	if c := t.current(); c != nil {
 		return c.Query(query, args...)
 	}
-	return t.db.Query(query, args...)
+	return t.primary().Query(query, args...)
 }
 
 func (t *kdb) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
 	if c := t.current(); c != nil {
 		return c.QueryRowContext(ctx, query, args...)
 	}
-	return t.db.QueryRowContext(ctx, query, args...)
+	return t.primary().QueryRowContext(ctx, query, args...)
 }
 
 func (t *kdb) QueryRow(query string, args ...interface{}) *sql.Row {
 	if c := t.current(); c != nil {
 		return c.QueryRow(query, args...)
 	}
-	return t.db.QueryRow(query, args...)
+	return t.primary().QueryRow(query, args...)
 }
 
 func (t *kdb) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
 	if c := t.current(); c != nil {
 		return c.PrepareContext(ctx, query)
 	}
-	return t.db.PrepareContext(ctx, query)
+	return t.primary().PrepareContext(ctx, query)
 }
 
 func (t *kdb) Prepare(query string) (*sql.Stmt, error) {
 	if c := t.current(); c != nil {
 		return c.Prepare(query)
 	}
-	return t.db.Prepare(query)
+	return t.primary().Prepare(query)
 }
@@ -0,0 +1,74 @@
+package korm
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// 创建带从库的假连接
+func newReplicaDb(conn string, primary string, replicas ...string) *kdb {
+	db, _ := sql.Open(fakeDriverName, primary)
+	k := &kdb{
+		db:         db,
+		config:     &Config{},
+		dbConf:     &DbConfig{Conn: conn, Driver: "mysql"},
+		currentKey: newQueue(),
+		tx:         make(map[int]*sql.Tx),
+	}
+	for _, dsn := range replicas {
+		rdb, _ := sql.Open(fakeDriverName, dsn)
+		k.replicas = append(k.replicas, rdb)
+	}
+	mainConnect.dbList[conn] = k
+	return k
+}
+
+// 测试读写分离
+func TestReplicaRouting(t *testing.T) {
+	primary := setFakeTable("rw_primary", []string{"id"}, nil)
+	replica1 := setFakeTable("rw_replica1", []string{"id"}, nil)
+	replica2 := setFakeTable("rw_replica2", []string{"id"}, nil)
+	newReplicaDb("rw", "rw_primary", "rw_replica1", "rw_replica2")
+	ctx := UseContext("rw")
+
+	var rows []TestBench
+	assert.NoError(t, ctx.Model(&rows).Select().Error)
+	_, _ = ctx.Model(&TestBench{}).Count()
+	assert.Len(t, replica1.queries, 1)
+	assert.Len(t, replica2.queries, 1)
+	assert.Empty(t, primary.queries)
+
+	assert.NoError(t, ctx.Model(&TestBench{User: "a"}).Create())
+	assert.NoError(t, ctx.Model(&rows).UsePrimary().Select().Error)
+	assert.NoError(t, ctx.Transaction(func() error {
+		return ctx.Model(&rows).Select().Error
+	}))
+	assert.Len(t, primary.queries, 3)
+	assert.Len(t, replica1.queries, 1)
+	assert.Len(t, replica2.queries, 1)
+
+	k := newReplicaDb("rw_least", "rw_primary", "rw_replica1", "rw_replica2")
+	k.dbConf.ReplicaPolicy = ReplicaLeastConn
+	assert.Equal(t, k.replicas[0], k.reader())
+}
+
+// 测试指定读主库时关联数据同样从主库加载
+func TestReplicaRelation(t *testing.T) {
+	primary := setFakeTable("rel_primary", nil, nil)
+	primary.pages = []fakePage{
+		{columns: []string{"id"}, rows: [][]driver.Value{{int64(1)}}},
+		{columns: []string{"id", "order_id"}, rows: [][]driver.Value{{int64(5), int64(1)}}},
+	}
+	replica := setFakeTable("rel_replica", []string{"id"}, nil)
+	newReplicaDb("rw_rel", "rel_primary", "rel_replica")
+
+	var rows []TestConnOrder
+	assert.NoError(t, UseContext("rw_rel").Model(&rows).UsePrimary().With("Items").Select().Error)
+	assert.Len(t, primary.queries, 2)
+	assert.Empty(t, replica.queries)
+	if assert.Len(t, rows, 1) && assert.Len(t, rows[0].Items, 1) {
+		assert.Equal(t, int64(5), rows[0].Items[0].Id)
+	}
+}
@@ -0,0 +1,215 @@
+package korm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+)
+
+// 测试用的假数据库驱动, dsn为数据集名称, 名为down的数据集无法连接
+const fakeDriverName = "kormfake"
+
+var fakeTables sync.Map
+
+// 手动设置为不可用的数据集
+var fakeDowns sync.Map
+
+type fakeTable struct {
+	lock    sync.Mutex
+	columns []string
+	rows    [][]driver.Value
+	pages   []fakePage // 依次返回的数据, 用完后返回columns及rows
+	results []int64    // 依次返回的影响行数, 用完后为1
+	queries []string
+	args    [][]driver.Value
+}
+
+func init() {
+	sql.Register(fakeDriverName, fakeDriver{})
+}
+
+// 设置数据集返回的数据
+func setFakeTable(dsn string, columns []string, rows [][]driver.Value) *fakeTable {
+	table := &fakeTable{columns: columns, rows: rows}
+	fakeTables.Store(dsn, table)
+	return table
+}
+
+// 设置数据集是否不可用
+func setFakeDown(dsn string, down bool) {
+	if down {
+		fakeDowns.Store(dsn, true)
+	} else {
+		fakeDowns.Delete(dsn)
+	}
+}
+
+func isFakeDown(dsn string) bool {
+	if dsn == "down" {
+		return true
+	}
+	_, ok := fakeDowns.Load(dsn)
+	return ok
+}
+
+// 创建连接假数据集的模型
+func newFakeModel(dsn string, mod interface{}) *Model {
+	db, _ := sql.Open(fakeDriverName, dsn)
+	mainConnect.dbList[dsn] = &kdb{
+		db:         db,
+		config:     &Config{},
+		dbConf:     &DbConfig{Conn: dsn, Driver: "mysql"},
+		currentKey: newQueue(),
+		tx:         make(map[int]*sql.Tx),
+	}
+	return UseContext(dsn).Model(mod)
+}
+
+func (t *fakeTable) record(query string, args []driver.Value) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.queries = append(t.queries, query)
+	t.args = append(t.args, args)
+}
+
+// 单次查询返回的数据, columns为空时使用数据集的列
+type fakePage struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+// 本次查询返回的数据
+func (t *fakeTable) next() *fakeRows {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if len(t.pages) > 0 {
+		page := t.pages[0]
+		t.pages = t.pages[1:]
+		if page.columns == nil {
+			page.columns = t.columns
+		}
+		return &fakeRows{columns: page.columns, rows: page.rows}
+	}
+	return &fakeRows{columns: t.columns, rows: t.rows}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	if isFakeDown(dsn) {
+		return nil, errors.New("fake: connection refused")
+	}
+	return &fakeConn{dsn: dsn}, nil
+}
+
+type fakeConn struct {
+	dsn string
+}
+
+func (c *fakeConn) table() *fakeTable {
+	if table, ok := fakeTables.Load(c.dsn); ok {
+		return table.(*fakeTable)
+	}
+	return &fakeTable{}
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{table: c.table(), query: query}, nil
+}
+
+func (c *fakeConn) Ping(ctx context.Context) error {
+	if isFakeDown(c.dsn) {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error {
+	return nil
+}
+
+func (fakeTx) Rollback() error {
+	return nil
+}
+
+type fakeStmt struct {
+	table *fakeTable
+	query string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.table.record(s.query, args)
+	return s.table.result(), nil
+}
+
+// 本次执行的结果
+func (t *fakeTable) result() fakeResult {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if len(t.results) > 0 {
+		r := t.results[0]
+		t.results = t.results[1:]
+		return fakeResult(r)
+	}
+	return fakeResult(1)
+}
+
+// 执行结果, 自增id与影响行数均为该值
+type fakeResult int64
+
+func (r fakeResult) LastInsertId() (int64, error) {
+	return int64(r), nil
+}
+
+func (r fakeResult) RowsAffected() (int64, error) {
+	return int64(r), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.table.record(s.query, args)
+	return s.table.next(), nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+	pos     int
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.pos])
+	r.pos++
+	return nil
+}
@@ -4,4 +4,11 @@ import "errors"
 
 var (
 	ErrRecordNotFound = errors.New("record not found")
+	ErrStaleObject    = errors.New("stale object: record has been modified by others")
+	ErrInvalidCursor  = errors.New("invalid pagination cursor")
 )
+
+// 是否记录不存在的错误
+func IsRecordNotFound(err error) bool {
+	return errors.Is(err, ErrRecordNotFound)
+}
@@ -0,0 +1,198 @@
+package korm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPingTimeout       = 5  // 默认检查超时时间(秒)
+	defaultFailoverThreshold = 3  // 默认切换备用库前的连续失败次数
+	defaultFailoverGrace     = 30 // 默认旧连接池等待语句结束的时间(秒)
+)
+
+// 旧连接池检查是否空闲的间隔
+var drainInterval = 100 * time.Millisecond
+
+// 连接检查结果
+type HealthStatus struct {
+	Conn      string
+	Healthy   bool
+	Error     string
+	Latency   time.Duration
+	Failures  int  // 连续失败次数
+	Failover  bool // 是否已切换到备用库
+	CheckedAt time.Time
+	Replicas  []HealthStatus // 从库检查结果, 不可用的从库不参与读操作
+}
+
+// 检查所有连接及从库, 主库连续失败达到阈值且配置了备用库时切换
+func (c *Connect) Health() map[string]HealthStatus {
+	report := make(map[string]HealthStatus, len(c.dbList))
+	for name, db := range c.dbList {
+		report[name] = db.check()
+	}
+	return report
+}
+
+// 定时检查所有连接, 返回停止检查的函数
+func (c *Connect) StartHealthCheck(interval time.Duration) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				c.Health()
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+		})
+	}
+}
+
+// 当前主库连接池
+func (t *kdb) primary() *sql.DB {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.db
+}
+
+// 在超时时间内ping连接
+func (t *kdb) ping(db *sql.DB) error {
+	timeout := t.config.PingTimeout
+	if timeout <= 0 {
+		timeout = defaultPingTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+	return db.PingContext(ctx)
+}
+
+// 启动时检查主库, 不可用时尝试备用库
+func (t *kdb) startupPing() error {
+	err := t.ping(t.primary())
+	if err == nil {
+		return nil
+	}
+	if t.dbConf.Failover == nil {
+		return fmt.Errorf("ping fail: %v", err)
+	}
+	return t.switchFailover(err)
+}
+
+// 检查主库及从库并记录结果
+func (t *kdb) check() HealthStatus {
+	t.checkReplicas()
+	start := time.Now()
+	err := t.ping(t.primary())
+
+	t.lock.Lock()
+	t.health.CheckedAt = start
+	t.health.Latency = time.Since(start)
+	t.health.Healthy = err == nil
+	t.health.Error = ""
+	if err != nil {
+		t.health.Error = err.Error()
+		t.health.Failures++
+	} else {
+		t.health.Failures = 0
+	}
+	threshold := t.config.FailoverThreshold
+	if threshold <= 0 {
+		threshold = defaultFailoverThreshold
+	}
+	needFailover := err != nil && t.health.Failures >= threshold && t.dbConf.Failover != nil && !t.health.Failover
+	t.lock.Unlock()
+
+	if needFailover {
+		if e := t.switchFailover(err); e != nil {
+			t.lock.Lock()
+			t.health.Error = e.Error()
+			t.lock.Unlock()
+		}
+	}
+
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	status := t.health
+	status.Replicas = append([]HealthStatus(nil), t.health.Replicas...)
+	return status
+}
+
+// 检查从库, 记录结果供读操作选择从库
+func (t *kdb) checkReplicas() {
+	for i, db := range t.replicas {
+		start := time.Now()
+		err := t.ping(db)
+
+		t.lock.Lock()
+		if i < len(t.health.Replicas) {
+			status := &t.health.Replicas[i]
+			status.CheckedAt = start
+			status.Latency = time.Since(start)
+			status.Healthy = err == nil
+			status.Error = ""
+			if err != nil {
+				status.Error = err.Error()
+				status.Failures++
+			} else {
+				status.Failures = 0
+			}
+		}
+		t.lock.Unlock()
+	}
+}
+
+// 切换到备用库, 备用库同样不可用或有未结束的事务时保持原连接
+func (t *kdb) switchFailover(cause error) error {
+	// 事务绑定在原连接池上, 关闭会导致事务失效, 等待事务结束后的下一次检查再切换
+	if t.currentKey != nil && t.currentKey.len() > 0 {
+		return fmt.Errorf("ping fail: %v, failover skipped: transaction in progress", cause)
+	}
+	db, err := openDb(t.config, t.dbConf.replicaConfig(*t.dbConf.Failover))
+	if err == nil {
+		if err = t.ping(db); err != nil {
+			_ = db.Close()
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("ping fail: %v, failover fail: %v", cause, err)
+	}
+
+	t.lock.Lock()
+	old := t.db
+	t.db = db
+	t.health.Healthy = true
+	t.health.Error = ""
+	t.health.Failures = 0
+	t.health.Failover = true
+	t.lock.Unlock()
+	if old != nil {
+		go t.drain(old)
+	}
+	return nil
+}
+
+// 等待旧连接池中进行中的语句结束后关闭, 超过等待时间时直接关闭
+func (t *kdb) drain(db *sql.DB) {
+	grace := t.config.FailoverGrace
+	if grace <= 0 {
+		grace = defaultFailoverGrace
+	}
+	deadline := time.Now().Add(time.Duration(grace) * time.Second)
+	for db.Stats().InUse > 0 && time.Now().Before(deadline) {
+		time.Sleep(drainInterval)
+	}
+	_ = db.Close()
+}
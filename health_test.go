@@ -0,0 +1,189 @@
+package korm
+
+import (
+	"database/sql/driver"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// 测试启动检查
+func TestStartupPing(t *testing.T) {
+	_, err := NewDb(&Config{}, &DbConfig{Conn: "hc_down", Driver: fakeDriverName, Dsn: "down"})
+	assert.Error(t, err)
+
+	db, err := NewDb(&Config{}, &DbConfig{
+		Conn:     "hc_startup",
+		Driver:   fakeDriverName,
+		Dsn:      "down",
+		Failover: &DbConfig{Dsn: "hc_startup_backup"},
+	})
+	assert.NoError(t, err)
+	if assert.NotNil(t, db) {
+		assert.True(t, db.health.Failover)
+		db.close()
+	}
+}
+
+// 测试健康检查及故障切换
+func TestHealthFailover(t *testing.T) {
+	db, err := NewDb(&Config{FailoverThreshold: 2}, &DbConfig{
+		Conn:     "hc_primary",
+		Driver:   fakeDriverName,
+		Dsn:      "hc_primary",
+		Failover: &DbConfig{Dsn: "hc_backup"},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	c := &Connect{dbList: map[string]*kdb{"hc_primary": db}}
+	defer c.Close()
+
+	status := c.Health()["hc_primary"]
+	assert.True(t, status.Healthy)
+	assert.False(t, status.Failover)
+
+	setFakeDown("hc_primary", true)
+	defer setFakeDown("hc_primary", false)
+	status = c.Health()["hc_primary"]
+	assert.False(t, status.Healthy)
+	assert.Equal(t, 1, status.Failures)
+	assert.NotEmpty(t, status.Error)
+
+	status = c.Health()["hc_primary"]
+	assert.True(t, status.Healthy)
+	assert.True(t, status.Failover)
+	assert.Equal(t, 0, status.Failures)
+
+	status = c.Health()["hc_primary"]
+	assert.True(t, status.Healthy)
+	assert.True(t, status.Failover)
+}
+
+// 测试有未结束的事务时不切换备用库
+func TestHealthFailoverInTransaction(t *testing.T) {
+	db, err := NewDb(&Config{FailoverThreshold: 1}, &DbConfig{
+		Conn:     "hc_tx",
+		Driver:   fakeDriverName,
+		Dsn:      "hc_tx",
+		Failover: &DbConfig{Dsn: "hc_tx_backup"},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	c := &Connect{dbList: map[string]*kdb{"hc_tx": db}}
+	defer c.Close()
+
+	key, err := db.Begin()
+	assert.NoError(t, err)
+	setFakeDown("hc_tx", true)
+	defer setFakeDown("hc_tx", false)
+	status := c.Health()["hc_tx"]
+	assert.False(t, status.Healthy)
+	assert.False(t, status.Failover)
+	assert.Contains(t, status.Error, "transaction in progress")
+
+	_ = db.Rollback(key)
+	status = c.Health()["hc_tx"]
+	assert.True(t, status.Healthy)
+	assert.True(t, status.Failover)
+}
+
+// 测试从库检查, 不可用的从库不参与读操作
+func TestHealthReplicas(t *testing.T) {
+	db, err := NewDb(&Config{}, &DbConfig{
+		Conn:     "hc_rw",
+		Driver:   fakeDriverName,
+		Dsn:      "hc_rw",
+		Replicas: []DbConfig{{Dsn: "hc_rw_r0"}, {Dsn: "hc_rw_r1"}},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	c := &Connect{dbList: map[string]*kdb{"hc_rw": db}}
+	defer c.Close()
+
+	setFakeDown("hc_rw_r0", true)
+	defer setFakeDown("hc_rw_r0", false)
+	status := c.Health()["hc_rw"]
+	assert.True(t, status.Healthy)
+	if assert.Len(t, status.Replicas, 2) {
+		assert.Equal(t, "hc_rw/replica0", status.Replicas[0].Conn)
+		assert.False(t, status.Replicas[0].Healthy)
+		assert.Equal(t, 1, status.Replicas[0].Failures)
+		assert.True(t, status.Replicas[1].Healthy)
+	}
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, db.replicas[1], db.reader())
+	}
+
+	setFakeDown("hc_rw_r1", true)
+	defer setFakeDown("hc_rw_r1", false)
+	c.Health()
+	assert.Equal(t, db.primary(), db.reader())
+}
+
+// 测试停止定时检查可重复调用
+func TestStartHealthCheckStop(t *testing.T) {
+	c := &Connect{dbList: map[string]*kdb{}}
+	stop := c.StartHealthCheck(time.Hour)
+	assert.NotPanics(t, func() {
+		stop()
+		stop()
+	})
+}
+
+// 测试切换后旧连接池等待进行中的语句结束再关闭
+func TestFailoverDrain(t *testing.T) {
+	drainInterval = time.Millisecond
+	defer func() { drainInterval = 100 * time.Millisecond }()
+	setFakeTable("hc_drain", []string{"id"}, [][]driver.Value{{int64(1)}, {int64(2)}})
+	db, err := NewDb(&Config{FailoverThreshold: 1}, &DbConfig{
+		Conn:     "hc_drain",
+		Driver:   fakeDriverName,
+		Dsn:      "hc_drain",
+		Failover: &DbConfig{Dsn: "hc_drain_backup"},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	c := &Connect{dbList: map[string]*kdb{"hc_drain": db}}
+	defer c.Close()
+
+	old := db.primary()
+	rows, err := old.Query("SELECT id FROM test")
+	if !assert.NoError(t, err) {
+		return
+	}
+	setFakeDown("hc_drain", true)
+	defer setFakeDown("hc_drain", false)
+	assert.True(t, c.Health()["hc_drain"].Failover)
+
+	// 进行中的查询仍可读取
+	time.Sleep(10 * time.Millisecond)
+	assert.True(t, rows.Next())
+	assert.True(t, rows.Next())
+	assert.NoError(t, rows.Close())
+	assert.Eventually(t, func() bool {
+		_, err := old.Prepare("SELECT 1")
+		return err != nil
+	}, time.Second, time.Millisecond)
+}
+
+// 测试启动时检查从库
+func TestStartupReplicaPing(t *testing.T) {
+	setFakeDown("hc_start_r0", true)
+	defer setFakeDown("hc_start_r0", false)
+	db, err := NewDb(&Config{}, &DbConfig{
+		Conn:     "hc_start",
+		Driver:   fakeDriverName,
+		Dsn:      "hc_start",
+		Replicas: []DbConfig{{Dsn: "hc_start_r0"}},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.close()
+	assert.False(t, db.health.Replicas[0].Healthy)
+	assert.Equal(t, db.primary(), db.reader())
+}
@@ -0,0 +1,112 @@
+package korm
+
+import (
+	"reflect"
+)
+
+const (
+	hookBeforeCreate = "before_create"
+	hookAfterCreate  = "after_create"
+	hookBeforeUpdate = "before_update"
+	hookAfterUpdate  = "after_update"
+	hookBeforeDelete = "before_delete"
+	hookAfterDelete  = "after_delete"
+	hookAfterFind    = "after_find"
+)
+
+// 以下为模型生命周期钩子, 数组模型会对每个元素调用
+// 前置钩子返回错误时中止操作; 后置钩子在语句执行后调用, 返回的错误仅交给调用方,
+// 已执行的语句不会回滚, 需要回滚时请在Transaction中操作
+
+// 创建前钩子
+type ModelBeforeCreate interface {
+	BeforeCreate(ctx *Context) error
+}
+
+// 创建后钩子
+type ModelAfterCreate interface {
+	AfterCreate(ctx *Context) error
+}
+
+// 更新前钩子
+type ModelBeforeUpdate interface {
+	BeforeUpdate(ctx *Context) error
+}
+
+// 更新后钩子
+type ModelAfterUpdate interface {
+	AfterUpdate(ctx *Context) error
+}
+
+// 删除前钩子
+type ModelBeforeDelete interface {
+	BeforeDelete(ctx *Context) error
+}
+
+// 删除后钩子
+type ModelAfterDelete interface {
+	AfterDelete(ctx *Context) error
+}
+
+// 查询后钩子
+type ModelAfterFind interface {
+	AfterFind(ctx *Context) error
+}
+
+// 调用模型钩子, 数组模型对每个元素调用
+func (m *Model) callHook(name string) error {
+	if !m.schema.Data.IsValid() {
+		return nil
+	}
+	if m.schema.IsArray() {
+		for i := 0; i < m.schema.Data.Len(); i++ {
+			if err := m.callRowHook(name, m.schema.Data.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return m.callRowHook(name, m.schema.Data)
+}
+
+// 调用单行数据的钩子
+func (m *Model) callRowHook(name string, value reflect.Value) error {
+	var row interface{}
+	if value.CanAddr() {
+		row = value.Addr().Interface()
+	} else {
+		row = value.Interface()
+	}
+
+	switch name {
+	case hookBeforeCreate:
+		if hook, ok := row.(ModelBeforeCreate); ok {
+			return hook.BeforeCreate(m.context)
+		}
+	case hookAfterCreate:
+		if hook, ok := row.(ModelAfterCreate); ok {
+			return hook.AfterCreate(m.context)
+		}
+	case hookBeforeUpdate:
+		if hook, ok := row.(ModelBeforeUpdate); ok {
+			return hook.BeforeUpdate(m.context)
+		}
+	case hookAfterUpdate:
+		if hook, ok := row.(ModelAfterUpdate); ok {
+			return hook.AfterUpdate(m.context)
+		}
+	case hookBeforeDelete:
+		if hook, ok := row.(ModelBeforeDelete); ok {
+			return hook.BeforeDelete(m.context)
+		}
+	case hookAfterDelete:
+		if hook, ok := row.(ModelAfterDelete); ok {
+			return hook.AfterDelete(m.context)
+		}
+	case hookAfterFind:
+		if hook, ok := row.(ModelAfterFind); ok {
+			return hook.AfterFind(m.context)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package korm
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type TestHook struct {
+	Id   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+func (t *TestHook) AfterFind(ctx *Context) error {
+	t.Name = "found"
+	return nil
+}
+
+func (t *TestHook) BeforeCreate(ctx *Context) error {
+	if t.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+// 测试模型钩子调用
+func TestModelHook(t *testing.T) {
+	rows := []TestHook{{Id: 1}, {Id: 2}}
+	assert.NoError(t, newTestModel(&rows).callHook(hookAfterFind))
+	assert.Equal(t, "found", rows[0].Name)
+	assert.Equal(t, "found", rows[1].Name)
+
+	row := &TestHook{}
+	assert.EqualError(t, newTestModel(&row).Create(), "name is required")
+}
+
+type TestHookAfter struct {
+	Id   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+func (t *TestHookAfter) AfterCreate(ctx *Context) error {
+	return errors.New("notify fail")
+}
+
+// 测试后置钩子的错误不回滚已执行的语句
+func TestAfterHookError(t *testing.T) {
+	table := setFakeTable("hook_after", nil, nil)
+	row := &TestHookAfter{Name: "a"}
+	assert.EqualError(t, newFakeModel("hook_after", row).Create(), "notify fail")
+	assert.Len(t, table.queries, 1)
+	assert.Equal(t, int64(1), row.Id)
+}
@@ -0,0 +1,269 @@
+package korm
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 指标收集接口, 通过Config.Metrics接入外部监控
+type MetricsSink interface {
+	// 每次执行语句后调用, err为空表示成功
+	ObserveQuery(conn string, action string, duration time.Duration, err error)
+	// 每次读取结果后调用
+	ObserveRows(conn string, action string, rows int)
+	// 事务提交或回滚后调用
+	ObserveTx(conn string, duration time.Duration, committed bool)
+}
+
+// 连接统计
+type Stats struct {
+	Conn          string
+	DB            sql.DBStats              // 连接池统计, 包含从库
+	Queries       map[string]int64         // 按操作统计的执行次数
+	Errors        map[string]int64         // 按操作统计的错误次数
+	QueryDuration map[string]time.Duration // 按操作统计的累计耗时
+	RowsScanned   int64
+	TxCommits     int64
+	TxRollbacks   int64
+	TxDuration    time.Duration // 事务累计耗时
+	TxMaxDuration time.Duration // 单个事务最大耗时
+}
+
+// korm层面的计数
+type queryStats struct {
+	lock          sync.Mutex
+	queries       map[string]int64
+	errors        map[string]int64
+	durations     map[string]time.Duration
+	rowsScanned   int64
+	txCommits     int64
+	txRollbacks   int64
+	txDuration    time.Duration
+	txMaxDuration time.Duration
+	txStart       map[int]time.Time
+}
+
+// 获取所有连接的统计
+func (c *Connect) Stats() map[string]Stats {
+	list := make(map[string]Stats, len(c.dbList))
+	for name, db := range c.dbList {
+		list[name] = db.statsSnapshot()
+	}
+	return list
+}
+
+// 以Prometheus文本格式输出统计
+func (c *Connect) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = w.Write([]byte(c.prometheusText()))
+	})
+}
+
+// Prometheus标签值转义, 只转义反斜杠、双引号及换行
+var promLabelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func promLabel(v string) string {
+	return promLabelReplacer.Replace(v)
+}
+
+// 生成Prometheus文本格式的统计
+func (c *Connect) prometheusText() string {
+	stats := c.Stats()
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	writeMetric := func(name string, kind string, help string, value func(s Stats, write func(labels string, v interface{}))) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for _, conn := range names {
+			value(stats[conn], func(labels string, v interface{}) {
+				fmt.Fprintf(&b, "%s{conn=\"%s\"%s} %v\n", name, promLabel(conn), labels, v)
+			})
+		}
+	}
+	single := func(fn func(s Stats) interface{}) func(s Stats, write func(labels string, v interface{})) {
+		return func(s Stats, write func(labels string, v interface{})) {
+			write("", fn(s))
+		}
+	}
+	byAction := func(fn func(s Stats, action string) interface{}) func(s Stats, write func(labels string, v interface{})) {
+		return func(s Stats, write func(labels string, v interface{})) {
+			actions := make([]string, 0, len(s.Queries))
+			for action := range s.Queries {
+				actions = append(actions, action)
+			}
+			sort.Strings(actions)
+			for _, action := range actions {
+				write(fmt.Sprintf(",action=\"%s\"", promLabel(action)), fn(s, action))
+			}
+		}
+	}
+
+	writeMetric("korm_db_max_open_connections", "gauge", "Maximum number of open connections.", single(func(s Stats) interface{} {
+		return s.DB.MaxOpenConnections
+	}))
+	writeMetric("korm_db_open_connections", "gauge", "Number of established connections.", single(func(s Stats) interface{} {
+		return s.DB.OpenConnections
+	}))
+	writeMetric("korm_db_in_use_connections", "gauge", "Number of connections currently in use.", single(func(s Stats) interface{} {
+		return s.DB.InUse
+	}))
+	writeMetric("korm_db_idle_connections", "gauge", "Number of idle connections.", single(func(s Stats) interface{} {
+		return s.DB.Idle
+	}))
+	writeMetric("korm_db_wait_count_total", "counter", "Total number of connections waited for.", single(func(s Stats) interface{} {
+		return s.DB.WaitCount
+	}))
+	writeMetric("korm_db_wait_duration_seconds_total", "counter", "Total time blocked waiting for a new connection.", single(func(s Stats) interface{} {
+		return s.DB.WaitDuration.Seconds()
+	}))
+	writeMetric("korm_queries_total", "counter", "Total number of executed statements.", byAction(func(s Stats, action string) interface{} {
+		return s.Queries[action]
+	}))
+	writeMetric("korm_query_errors_total", "counter", "Total number of failed statements.", byAction(func(s Stats, action string) interface{} {
+		return s.Errors[action]
+	}))
+	writeMetric("korm_query_duration_seconds_total", "counter", "Total time spent executing statements.", byAction(func(s Stats, action string) interface{} {
+		return s.QueryDuration[action].Seconds()
+	}))
+	writeMetric("korm_rows_scanned_total", "counter", "Total number of rows scanned.", single(func(s Stats) interface{} {
+		return s.RowsScanned
+	}))
+	writeMetric("korm_transactions_total", "counter", "Total number of finished transactions.", func(s Stats, write func(labels string, v interface{})) {
+		write(`,result="commit"`, s.TxCommits)
+		write(`,result="rollback"`, s.TxRollbacks)
+	})
+	writeMetric("korm_transaction_duration_seconds_total", "counter", "Total time spent in transactions.", single(func(s Stats) interface{} {
+		return s.TxDuration.Seconds()
+	}))
+	writeMetric("korm_transaction_max_duration_seconds", "gauge", "Longest transaction duration.", single(func(s Stats) interface{} {
+		return s.TxMaxDuration.Seconds()
+	}))
+	return b.String()
+}
+
+// 当前连接的统计副本
+func (t *kdb) statsSnapshot() Stats {
+	s := Stats{
+		Conn:          t.dbConf.Conn,
+		Queries:       make(map[string]int64),
+		Errors:        make(map[string]int64),
+		QueryDuration: make(map[string]time.Duration),
+	}
+	for _, db := range append([]*sql.DB{t.primary()}, t.replicas...) {
+		addDBStats(&s.DB, db.Stats())
+	}
+
+	t.stats.lock.Lock()
+	defer t.stats.lock.Unlock()
+	for k, v := range t.stats.queries {
+		s.Queries[k] = v
+	}
+	for k, v := range t.stats.errors {
+		s.Errors[k] = v
+	}
+	for k, v := range t.stats.durations {
+		s.QueryDuration[k] = v
+	}
+	s.RowsScanned = t.stats.rowsScanned
+	s.TxCommits = t.stats.txCommits
+	s.TxRollbacks = t.stats.txRollbacks
+	s.TxDuration = t.stats.txDuration
+	s.TxMaxDuration = t.stats.txMaxDuration
+	return s
+}
+
+// 累加连接池统计
+func addDBStats(dst *sql.DBStats, src sql.DBStats) {
+	dst.MaxOpenConnections += src.MaxOpenConnections
+	dst.OpenConnections += src.OpenConnections
+	dst.InUse += src.InUse
+	dst.Idle += src.Idle
+	dst.WaitCount += src.WaitCount
+	dst.WaitDuration += src.WaitDuration
+	dst.MaxIdleClosed += src.MaxIdleClosed
+	dst.MaxIdleTimeClosed += src.MaxIdleTimeClosed
+	dst.MaxLifetimeClosed += src.MaxLifetimeClosed
+}
+
+// 记录一次语句执行, 未找到记录不算错误
+func (t *kdb) observeQuery(action string, start time.Time, err error) {
+	duration := time.Since(start)
+	t.stats.lock.Lock()
+	if t.stats.queries == nil {
+		t.stats.queries = make(map[string]int64)
+		t.stats.errors = make(map[string]int64)
+		t.stats.durations = make(map[string]time.Duration)
+	}
+	t.stats.queries[action]++
+	t.stats.durations[action] += duration
+	if err != nil && !IsRecordNotFound(err) {
+		t.stats.errors[action]++
+	} else {
+		err = nil
+	}
+	t.stats.lock.Unlock()
+
+	if sink := t.config.Metrics; sink != nil {
+		sink.ObserveQuery(t.dbConf.Conn, action, duration, err)
+	}
+}
+
+// 记录读取的行数
+func (t *kdb) observeRows(action string, rows int) {
+	if rows == 0 {
+		return
+	}
+	t.stats.lock.Lock()
+	t.stats.rowsScanned += int64(rows)
+	t.stats.lock.Unlock()
+
+	if sink := t.config.Metrics; sink != nil {
+		sink.ObserveRows(t.dbConf.Conn, action, rows)
+	}
+}
+
+// 记录事务开始时间
+func (t *kdb) observeTxBegin(key int) {
+	t.stats.lock.Lock()
+	defer t.stats.lock.Unlock()
+	if t.stats.txStart == nil {
+		t.stats.txStart = make(map[int]time.Time)
+	}
+	t.stats.txStart[key] = time.Now()
+}
+
+// 记录事务结束及耗时
+func (t *kdb) observeTxEnd(key int, committed bool) {
+	t.stats.lock.Lock()
+	start, ok := t.stats.txStart[key]
+	if !ok {
+		t.stats.lock.Unlock()
+		return
+	}
+	delete(t.stats.txStart, key)
+	duration := time.Since(start)
+	if committed {
+		t.stats.txCommits++
+	} else {
+		t.stats.txRollbacks++
+	}
+	t.stats.txDuration += duration
+	if duration > t.stats.txMaxDuration {
+		t.stats.txMaxDuration = duration
+	}
+	t.stats.lock.Unlock()
+
+	if sink := t.config.Metrics; sink != nil {
+		sink.ObserveTx(t.dbConf.Conn, duration, committed)
+	}
+}
@@ -0,0 +1,96 @@
+package korm
+
+import (
+	"database/sql/driver"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testSink struct {
+	queries []string
+	rows    int
+	txs     []bool
+}
+
+func (s *testSink) ObserveQuery(conn string, action string, duration time.Duration, err error) {
+	s.queries = append(s.queries, action)
+}
+
+func (s *testSink) ObserveRows(conn string, action string, rows int) {
+	s.rows += rows
+}
+
+func (s *testSink) ObserveTx(conn string, duration time.Duration, committed bool) {
+	s.txs = append(s.txs, committed)
+}
+
+// 测试连接统计及指标输出
+func TestStats(t *testing.T) {
+	setFakeTable("stats", []string{"id", "user"}, [][]driver.Value{{int64(1), []byte("a")}, {int64(2), []byte("b")}})
+	var rows []TestBench
+	m := newFakeModel("stats", &rows)
+	db := mainConnect.dbList["stats"]
+	sink := &testSink{}
+	db.config.Metrics = sink
+	defer delete(mainConnect.dbList, "stats")
+
+	assert.NoError(t, m.Select().Error)
+	assert.NoError(t, UseContext("stats").Model(&TestBench{Id: 1}).Update())
+	ctx := UseContext("stats")
+	raw, err := ctx.Query("SELECT 1")
+	if assert.NoError(t, err) {
+		_ = raw.Close()
+	}
+	_, err = ctx.Exec("UPDATE test_bench SET score=1")
+	assert.NoError(t, err)
+	// 聚合查询按各自的操作名统计
+	_, _ = ctx.Model(&TestBench{}).Count()
+	var sum, max, min float64
+	_ = ctx.Model(&TestBench{}).Sum("Score", &sum)
+	_ = ctx.Model(&TestBench{}).Max("Score", &max)
+	_ = ctx.Model(&TestBench{}).Min("Score", &min)
+	_ = ctx.Model(&TestBench{}).Avg("Score", &sum)
+	_ = ctx.Model(&TestBench{}).Value("Score", &sum)
+	assert.NoError(t, ctx.Transaction(func() error {
+		return nil
+	}))
+	assert.Error(t, ctx.Transaction(func() error {
+		return errors.New("cancel")
+	}))
+
+	c := &Connect{dbList: map[string]*kdb{"stats": db}}
+	s := c.Stats()["stats"]
+	assert.Equal(t, int64(1), s.Queries["select"])
+	assert.Equal(t, int64(1), s.Queries["update"])
+	assert.Equal(t, int64(1), s.Queries["query"])
+	assert.Equal(t, int64(1), s.Queries["exec"])
+	for _, action := range []string{"count", "sum", "max", "min", "avg", "value"} {
+		assert.Equal(t, int64(1), s.Queries[action], action)
+	}
+	assert.Equal(t, int64(0), s.Errors["select"])
+	assert.Equal(t, int64(8), s.RowsScanned)
+	assert.Equal(t, int64(1), s.TxCommits)
+	assert.Equal(t, int64(1), s.TxRollbacks)
+	assert.Equal(t, []string{"select", "update", "query", "exec", "count", "sum", "max", "min", "avg", "value"}, sink.queries)
+	assert.Equal(t, 8, sink.rows)
+	assert.Equal(t, []bool{true, false}, sink.txs)
+
+	w := httptest.NewRecorder()
+	c.MetricsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain"))
+	assert.Contains(t, body, "# TYPE korm_queries_total counter\n")
+	assert.Contains(t, body, `korm_queries_total{conn="stats",action="select"} 1`)
+	assert.Contains(t, body, `korm_rows_scanned_total{conn="stats"} 8`)
+	assert.Contains(t, body, `korm_transactions_total{conn="stats",result="rollback"} 1`)
+}
+
+// 测试指标标签转义
+func TestPromLabel(t *testing.T) {
+	assert.Equal(t, `a\\b\"c\nd`, promLabel("a\\b\"c\nd"))
+	assert.Equal(t, "连接\t", promLabel("连接\t"))
+}
@@ -8,6 +8,7 @@ type ModelTable interface {
 	Table() string
 }
 
+// 主键字段名, 复合主键以,分隔
 type ModelPk interface {
 	Pk() string
 }
@@ -7,6 +7,12 @@ import (
 	"github.com/wdaglb/korm/schema"
 	"github.com/wdaglb/korm/utils"
 	"reflect"
+	"time"
+)
+
+const (
+	trashedWith = "with" // 包含已软删除数据
+	trashedOnly = "only" // 仅查询已软删除数据
 )
 
 type Model struct {
@@ -21,26 +27,63 @@ type Model struct {
 	relationData    map[string][]*relation
 	relationMap     map[string]*relation
 	cancelTogethers []string // 取消关联数据同步操作
+	trashed         string   // 软删除数据查询方式
+	forceDelete     bool     // 忽略软删除, 直接删除
+	pkScoped        bool     // 已按主键列表限定条件, 不再使用模型的主键值
+	session         bool     // 会话模式, 执行时使用副本, 条件可重复使用
+	unscoped        bool     // 忽略模型的默认查询范围
+	usePrimary      bool     // 读操作使用主库
+	err             error    // 构建查询时产生的错误, 执行时返回
 }
 
-// 转为map
-func (m *Model) toMap(rows *sql.Rows) (map[string]interface{}, error) {
-	row := make(map[string]interface{})
-	fields, _ := rows.Columns()
-	values := make([][]byte, len(fields))
-	scans := make([]interface{}, len(fields))
-	for i := range values {
-		scans[i] = &values[i]
-	}
-	if err := rows.Scan(scans...); err != nil {
-		return nil, err
+// 主键in条件每批的数量
+const pkChunkSize = 1000
+
+// 复制模型及查询条件, 副本与原模型共享数据目标
+func (m *Model) Clone() *Model {
+	return m.clone()
+}
+
+// 会话模式, 查询、修改在副本上执行, 执行后条件保持不变, 可多次使用同一组条件
+// 链式方法仍修改会话本身, 单次使用的条件通过Clone添加
+func (m *Model) Session() *Model {
+	c := m.clone()
+	c.session = true
+	return c
+}
+
+// 执行操作的模型, 会话模式下为副本, 只在执行方法入口调用
+func (m *Model) instance() *Model {
+	if !m.session {
+		return m
 	}
-	for k, v := range values {
-		key := fields[k]
-		row[key] = string(v)
+	c := m.clone()
+	c.session = false
+	return c
+}
+
+// 复制模型及查询条件, 副本的修改不影响原模型
+func (m *Model) clone() *Model {
+	c := *m
+	c.builder = m.builder.clone(&c)
+	c.withList = make(map[string]WithCond, len(m.withList))
+	for k, v := range m.withList {
+		c.withList[k] = v
 	}
+	c.cancelTogethers = append([]string(nil), m.cancelTogethers...)
+	c.collection = nil
+	c.relationData = nil
+	c.relationMap = nil
+	return &c
+}
 
-	return row, nil
+// 创建当前查询的行扫描器
+func (m *Model) newRowScanner(rows *sql.Rows) (*schema.RowScanner, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	return m.schema.NewRowScanner(columns), nil
 }
 
 // 关联加载
@@ -81,6 +124,12 @@ func (m *Model) Where(field string, op interface{}, condition ...interface{}) *M
 	return m
 }
 
+// 原生条件, 参数使用?占位
+func (m *Model) WhereRaw(sql string, args ...interface{}) *Model {
+	m.builder.AddWhereRaw("and", sql, args...)
+	return m
+}
+
 func (m *Model) WhereOr(field string, op interface{}, condition ...interface{}) *Model {
 	m.builder.AddWhere("or", field, op, condition...)
 	return m
@@ -139,20 +188,65 @@ func (m *Model) HavingOr(field string, op interface{}, condition ...interface{})
 	return m
 }
 
-// 获取一行数据
-func (m *Model) Find() *Collection {
+// 读操作使用主库, 用于写入后立即读取的场景
+func (m *Model) UsePrimary() *Model {
+	m.usePrimary = true
+	return m
+}
+
+// 忽略模型的默认查询范围
+func (m *Model) Unscoped() *Model {
+	m.unscoped = true
+	return m
+}
+
+// 查询包含已软删除的数据
+func (m *Model) WithTrashed() *Model {
+	m.trashed = trashedWith
+	return m
+}
+
+// 仅查询已软删除的数据
+func (m *Model) OnlyTrashed() *Model {
+	m.trashed = trashedOnly
+	return m
+}
+
+// 获取一行数据, 可传入主键值, 复合主键按声明顺序传入
+func (m *Model) Find(pk ...interface{}) *Collection {
+	m = m.instance()
 	m.collection = NewCollection()
+	if len(pk) > len(m.schema.PrimaryKeys) {
+		return m.collection.SetError(fmt.Errorf("too many primary key values: %d", len(pk)))
+	}
+	// 主键条件只用于本次查询, 结束后恢复
+	scope := m.builder.scope
+	defer m.resetScope(scope)
+	for i, v := range pk {
+		m.builder.AddScope(m.schema.PrimaryKeys[i], v)
+	}
 
 	m.collection.Type = "find"
 	if m.schema.TableName == "" {
 		return m.collection.SetError(errors.New("table is not set"))
 	}
+	if !m.schema.Data.CanSet() {
+		return m.collection.SetError(errors.New("find dst must be a pointer"))
+	}
+	if err := m.emitBefore(EventQueryBefore, "find"); err != nil {
+		return m.collection.SetError(err)
+	}
 	db := m.db
 	m.builder.p = "select"
 	sqlStr, bindParams := m.builder.ToString()
 	// sqlStr := fmt.Sprintf("SELECT * FROM %s WHERE id=?", m.table)
+	start, scanned := time.Now(), 0
+	defer func() {
+		db.observeQuery("find", start, m.collection.Error)
+		db.observeRows("find", scanned)
+	}()
 
-	stmt, err := db.Prepare(sqlStr)
+	stmt, err := db.prepareRead(sqlStr, m.usePrimary)
 	if err != nil {
 		return m.collection.SetError(fmt.Errorf("prepare fail: %v", err))
 	}
@@ -164,44 +258,260 @@ func (m *Model) Find() *Collection {
 	defer rows.Close()
 
 	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return m.collection.SetError(fmt.Errorf("query fail: %v", err))
+		}
 		return m.collection.SetExist(false).SetError(ErrRecordNotFound)
 	}
 
-	ret, err := m.toMap(rows)
+	scanner, err := m.newRowScanner(rows)
 	if err != nil {
-		return m.collection.SetExist(true).SetError(fmt.Errorf("res to map fail: %v", err))
+		return m.collection.SetError(fmt.Errorf("query fail: %v", err))
 	}
-
-	for k, v := range m.schema.FieldNames {
-		if err := m.schema.SetFieldValue(k, ret[v.ColumnName]); err != nil {
-			return m.collection.SetExist(false).SetError(err)
-		}
+	ret, err := scanner.Scan(rows, m.schema.Data)
+	if err != nil {
+		return m.collection.SetExist(true).SetError(fmt.Errorf("scan fail: %v", err))
 	}
-	err = m.context.emitEvent("query_after", &CallbackParams{
+	scanned = 1
+	err = m.context.emitEvent(EventQueryAfter, &CallbackParams{
 		Action: "find",
 		Model:  m,
 		Rows:   rows,
 		Map:    ret,
 	})
+	if err == nil {
+		err = m.callHook(hookAfterFind)
+	}
 	m.collection.Fields = m.builder.resultFields
 	m.collection.Data = ret
 	return m.collection.SetExist(true).SetError(err)
 }
 
+// 按主键获取一行数据
+func (m *Model) FindByPk(values ...interface{}) *Collection {
+	return m.Find(values...)
+}
+
+// 获取一行数据, 记录不存在时返回ErrRecordNotFound, 其它错误为查询错误
+func (m *Model) FirstOrFail(pk ...interface{}) error {
+	return m.Find(pk...).Error
+}
+
+// 按主键列表获取数据集, 列表较大时分批查询
+func (m *Model) FindMany(ids interface{}) *Collection {
+	m = m.instance()
+	list := utils.ToInterfaceSlice(ids)
+	collection := NewCollection()
+	collection.Type = "select"
+	collection.Data = make([]map[string]interface{}, 0)
+	if !m.schema.IsArray() {
+		return collection.SetError(errors.New("find many dst must be a slice pointer"))
+	}
+	// Select每次会重置目标切片, 分批结果先合并再写回
+	all := reflect.MakeSlice(m.schema.Data.Type(), 0, 0)
+	defer func() { m.schema.Data.Set(all) }()
+	err := m.eachPkChunk(list, func() error {
+		c := m.Select()
+		if c.Error != nil {
+			return c.Error
+		}
+		all = reflect.AppendSlice(all, m.schema.Data)
+		collection.Fields = c.Fields
+		collection.Data = append(collection.Data.([]map[string]interface{}), c.Data.([]map[string]interface{})...)
+		collection.Exist = collection.Exist || c.Exist
+		return nil
+	})
+	m.collection = collection
+	return collection.SetError(err)
+}
+
+// 按主键顺序分批查询, 每批数据写入模型切片后调用fn, batch为传入模型的切片指针
+// 在模型副本上执行, 不修改调用方的条件; 以主键排序, 已设置排序时返回错误
+func (m *Model) Chunk(size int, fn func(batch interface{}) error) error {
+	m = m.clone()
+	if size <= 0 {
+		return fmt.Errorf("chunk size must be positive: %d", size)
+	}
+	if len(m.builder.orders) > 0 {
+		return errors.New("chunk orders by primary key, remove the custom order")
+	}
+	if !m.schema.IsArray() {
+		return errors.New("chunk dst must be a slice pointer")
+	}
+	if m.schema.IsCompositeKey() {
+		return errors.New("chunk requires a single primary key")
+	}
+	scope := m.builder.scope
+	// 以主键作为游标, 避免大偏移量的OFFSET扫描
+	m.OrderByAsc(m.schema.PrimaryKey)
+	m.Limit(size)
+	var last interface{}
+	for {
+		m.resetScope(scope)
+		if last != nil {
+			m.builder.AddScope(m.schema.PrimaryKey, ">", last)
+		}
+		m.schema.Data.Set(reflect.MakeSlice(m.schema.Data.Type(), 0, size))
+		if err := m.Select().Error; err != nil {
+			return err
+		}
+		count := m.schema.Data.Len()
+		if count == 0 {
+			return nil
+		}
+		if err := fn(m.model); err != nil {
+			return err
+		}
+		if count < size {
+			return nil
+		}
+		last = m.schema.GetArrayStructValue(count-1, m.schema.PrimaryKey).Interface()
+	}
+}
+
+// 恢复附加条件为scope的副本, 并清空上次查询的关联数据
+func (m *Model) resetScope(scope *Where) {
+	m.builder.scope = scope.clone(m.builder)
+	m.relationData = nil
+}
+
+// 按属性查询一行, 不存在时将属性及values填充到模型, Exist为false表示新实例
+func (m *Model) FirstOrNew(attrs map[string]interface{}, values ...map[string]interface{}) *Collection {
+	m = m.instance()
+	// 属性条件只用于本次查询, 结束后恢复
+	scope := m.builder.scope
+	defer m.resetScope(scope)
+	for _, k := range utils.SortedKeys(attrs) {
+		m.builder.AddScope(k, attrs[k])
+	}
+	coll := m.Find()
+	if coll.Exist || !IsRecordNotFound(coll.Error) {
+		return coll
+	}
+	if err := m.fillAttrs(append([]map[string]interface{}{attrs}, values...)...); err != nil {
+		return coll.SetError(err)
+	}
+	return coll.SetError(nil)
+}
+
+// 按属性查询一行, 不存在时创建, Exist为false表示本次新创建
+// mysql使用upsert写入, attrs对应唯一索引时并发创建只会保留一行并返回已存在的记录;
+// 其它数据库创建失败(如唯一索引冲突)时重新查询
+func (m *Model) FirstOrCreate(attrs map[string]interface{}, values ...map[string]interface{}) *Collection {
+	m = m.instance()
+	coll := m.FirstOrNew(attrs, values...)
+	if coll.Exist || coll.Error != nil {
+		return coll
+	}
+	if m.db.dbConf.Driver == "mysql" {
+		affected, err := m.sibling().insert("upsert", &upsertClause{conflict: utils.SortedKeys(attrs)})
+		if err == nil && affected == 0 {
+			// 已被其它请求创建, 读取已存在的记录
+			return m.sibling().UsePrimary().FirstOrNew(attrs)
+		}
+		return coll.SetError(err)
+	}
+	err := m.sibling().Create()
+	if err != nil {
+		if retry := m.sibling().UsePrimary().FirstOrNew(attrs); retry.Exist {
+			return retry
+		}
+	}
+	return coll.SetError(err)
+}
+
+// 按match查询一行, 存在时更新values, 不存在时创建, Exist为true表示更新了已有记录
+// mysql使用upsert写入, match对应唯一索引时并发创建会转为更新
+func (m *Model) UpdateOrCreate(match map[string]interface{}, values map[string]interface{}) *Collection {
+	m = m.instance()
+	coll := m.FirstOrNew(match, values)
+	if coll.Error != nil {
+		return coll
+	}
+	if coll.Exist {
+		if len(values) == 0 {
+			return coll
+		}
+		return coll.SetError(m.sibling().UpdateColumns(values))
+	}
+	if m.db.dbConf.Driver == "mysql" {
+		affected, err := m.sibling().insert("upsert", &upsertClause{
+			conflict: utils.SortedKeys(match),
+			updates:  m.upsertFields(nil, utils.SortedKeys(values)),
+		})
+		// mysql插入返回1, 更新已有记录返回2, 数据未变化返回0
+		return coll.SetExist(err == nil && affected != 1).SetError(err)
+	}
+	return coll.SetError(m.sibling().Create())
+}
+
+// 新的模型实例, 与当前模型使用相同的数据及连接
+func (m *Model) sibling() *Model {
+	n := m.context.Model(m.model)
+	n.db = m.db
+	return n
+}
+
+// 将属性写入模型字段
+func (m *Model) fillAttrs(attrs ...map[string]interface{}) error {
+	for _, item := range attrs {
+		for k, v := range item {
+			if m.schema.FieldNames[k] == nil {
+				return fmt.Errorf("field %s not found in %s", k, m.schema.Type.Name())
+			}
+			if err := m.schema.SetFieldValue(k, v); err != nil {
+				return fmt.Errorf("set field %s fail: %v", k, err)
+			}
+		}
+	}
+	return nil
+}
+
+// 按主键列表分批执行, 每批以in条件附加到查询
+func (m *Model) eachPkChunk(ids []interface{}, fn func() error) error {
+	scope := m.builder.scope
+	defer func() {
+		m.builder.scope = scope
+		m.pkScoped = false
+	}()
+	m.pkScoped = true
+	for start := 0; start < len(ids); start += pkChunkSize {
+		end := start + pkChunkSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		m.resetScope(scope)
+		m.builder.AddScopePkIn(ids[start:end])
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // 获取数据集
 func (m *Model) Select() *Collection {
+	m = m.instance()
 	m.collection = NewCollection()
 
 	m.collection.Type = "select"
 	if m.schema.TableName == "" {
 		return m.collection.SetError(errors.New("table is not set"))
 	}
+	if err := m.emitBefore(EventQueryBefore, "select"); err != nil {
+		return m.collection.SetError(err)
+	}
 	db := m.db
 	m.builder.p = "select"
 	sqlStr, bindParams := m.builder.ToString()
 	// sqlStr := fmt.Sprintf("SELECT * FROM %s WHERE id=?", m.table)
+	start, maps := time.Now(), make([]map[string]interface{}, 0)
+	defer func() {
+		db.observeQuery("select", start, m.collection.Error)
+		db.observeRows("select", len(maps))
+	}()
 
-	stmt, err := db.Prepare(sqlStr)
+	stmt, err := db.prepareRead(sqlStr, m.usePrimary)
 	if err != nil {
 		return m.collection.SetError(fmt.Errorf("prepare fail: %v", err))
 	}
@@ -212,32 +522,49 @@ func (m *Model) Select() *Collection {
 	}
 	defer rows.Close()
 
-	maps := make([]map[string]interface{}, 0)
+	scanner, err := m.newRowScanner(rows)
+	if err != nil {
+		return m.collection.SetError(fmt.Errorf("query fail: %v", err))
+	}
+	// 每次查询重新填充目标切片
+	m.schema.Data.Set(reflect.MakeSlice(m.schema.Data.Type(), 0, 0))
 	for rows.Next() {
-		ret, err := m.toMap(rows)
+		item := reflect.New(m.schema.Type).Elem()
+		ret, err := scanner.Scan(rows, item)
 		if err != nil {
-			return m.collection.SetError(fmt.Errorf("res to map fail: %v", err))
+			return m.collection.SetError(fmt.Errorf("scan fail: %v", err))
 		}
 		maps = append(maps, ret)
 
-		m.schema.AddArrayItem(ret)
+		m.schema.Data.Set(reflect.Append(m.schema.Data, item))
 		m.collection.SetExist(true)
 	}
+	if err = rows.Err(); err != nil {
+		return m.collection.SetError(fmt.Errorf("query fail: %v", err))
+	}
 
-	err = m.context.emitEvent("query_after", &CallbackParams{
+	err = m.context.emitEvent(EventQueryAfter, &CallbackParams{
 		Action:  "select",
 		Model:   m,
 		Rows:    rows,
 		MapRows: maps,
 	})
+	if err == nil {
+		err = m.callHook(hookAfterFind)
+	}
 
 	m.collection.Fields = m.builder.resultFields
 	m.collection.Data = maps
 	return m.collection.SetError(err)
 }
 
-// 获取一列数据
+// 获取一列数据, 在副本上查询, 不影响模型的字段设置
 func (m *Model) Value(col string, dst interface{}) *Collection {
+	return m.clone().value("value", col, dst)
+}
+
+// 查询单个值, action为记录统计及回调使用的操作名
+func (m *Model) value(action string, col string, dst interface{}) *Collection {
 	m.collection = NewCollection()
 
 	m.builder.clearField = true
@@ -245,12 +572,20 @@ func (m *Model) Value(col string, dst interface{}) *Collection {
 	if m.schema.TableName == "" {
 		return m.collection.SetError(fmt.Errorf("table is not set"))
 	}
+	if err := m.emitBefore(EventQueryBefore, action); err != nil {
+		return m.collection.SetError(err)
+	}
 	db := m.db
 	m.builder.p = "select"
 	sqlStr, bindParams := m.builder.ToString()
 	// sqlStr := fmt.Sprintf("SELECT * FROM %s WHERE id=?", m.table)
+	start, scanned := time.Now(), 0
+	defer func() {
+		db.observeQuery(action, start, m.collection.Error)
+		db.observeRows(action, scanned)
+	}()
 
-	stmt, err := db.Prepare(sqlStr)
+	stmt, err := db.prepareRead(sqlStr, m.usePrimary)
 	if err != nil {
 		return m.collection.SetError(fmt.Errorf("prepare fail: %v", err))
 	}
@@ -262,19 +597,25 @@ func (m *Model) Value(col string, dst interface{}) *Collection {
 	defer rows.Close()
 
 	if rows.Next() {
-		ret, err := m.toMap(rows)
+		scanner, err := m.newRowScanner(rows)
 		if err != nil {
 			return m.collection.SetError(err)
 		}
+		ret, err := scanner.Scan(rows, reflect.Value{})
+		if err != nil {
+			return m.collection.SetError(err)
+		}
+		scanned = 1
 		value := reflect.ValueOf(dst)
 		if value.Kind() == reflect.Ptr {
 			value = value.Elem()
 		}
-		utils.CallScan(ret[col], value)
-		// fmt.Printf("vvv: %v, %v\n", ret[col], col)
+		if err = schema.ScanValue(ret[col], value); err != nil {
+			return m.collection.SetError(err)
+		}
 
-		err = m.context.emitEvent("query_after", &CallbackParams{
-			Action: "value",
+		err = m.context.emitEvent(EventQueryAfter, &CallbackParams{
+			Action: action,
 			Model:  m,
 			Rows:   rows,
 			Map:    ret,
@@ -286,19 +627,122 @@ func (m *Model) Value(col string, dst interface{}) *Collection {
 	return m.collection.SetExist(false).SetError(ErrRecordNotFound)
 }
 
+// 获取一列的全部数据, dst为切片指针, 按元素类型转换
+func (m *Model) Pluck(col string, dst interface{}) error {
+	value := reflect.ValueOf(dst)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Slice {
+		return errors.New("pluck dst must be a slice pointer")
+	}
+	list := value.Elem()
+	return m.pluckRows("pluck", []string{col}, func(ret map[string]interface{}) error {
+		item := reflect.New(list.Type().Elem()).Elem()
+		if err := schema.ScanValue(ret[m.schema.FieldNameToColumnName(col)], item); err != nil {
+			return err
+		}
+		list.Set(reflect.Append(list, item))
+		return nil
+	})
+}
+
+// 获取两列数据组成map, dst为map指针, keyCol为键, valCol为值
+func (m *Model) PluckMap(keyCol string, valCol string, dst interface{}) error {
+	value := reflect.ValueOf(dst)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Map {
+		return errors.New("pluck map dst must be a map pointer")
+	}
+	data := value.Elem()
+	if data.IsNil() {
+		data.Set(reflect.MakeMap(data.Type()))
+	}
+	return m.pluckRows("pluck_map", []string{keyCol, valCol}, func(ret map[string]interface{}) error {
+		key := reflect.New(data.Type().Key()).Elem()
+		if err := schema.ScanValue(ret[m.schema.FieldNameToColumnName(keyCol)], key); err != nil {
+			return err
+		}
+		val := reflect.New(data.Type().Elem()).Elem()
+		if err := schema.ScanValue(ret[m.schema.FieldNameToColumnName(valCol)], val); err != nil {
+			return err
+		}
+		data.SetMapIndex(key, val)
+		return nil
+	})
+}
+
+// 查询指定列, 每行原始值交由fn处理
+func (m *Model) pluckRows(action string, cols []string, fn func(ret map[string]interface{}) error) (err error) {
+	m = m.clone()
+	if m.schema.TableName == "" {
+		return errors.New("table is not set")
+	}
+	m.builder.fields = []SqlField{}
+	for _, col := range cols {
+		m.builder.AddField(col)
+	}
+	if err = m.emitBefore(EventQueryBefore, action); err != nil {
+		return err
+	}
+	db := m.db
+	m.builder.p = "select"
+	sqlStr, bindParams := m.builder.ToString()
+	start, scanned := time.Now(), 0
+	defer func() {
+		db.observeQuery(action, start, err)
+		db.observeRows(action, scanned)
+	}()
+
+	stmt, err := db.prepareRead(sqlStr, m.usePrimary)
+	if err != nil {
+		return fmt.Errorf("prepare fail: %v", err)
+	}
+	defer stmt.Close()
+	rows, err := stmt.Query(bindParams...)
+	if err != nil {
+		return fmt.Errorf("query fail: %v", err)
+	}
+	defer rows.Close()
+
+	scanner, err := m.newRowScanner(rows)
+	if err != nil {
+		return fmt.Errorf("query fail: %v", err)
+	}
+	for rows.Next() {
+		ret, err := scanner.Scan(rows, reflect.Value{})
+		if err != nil {
+			return fmt.Errorf("scan fail: %v", err)
+		}
+		if err = fn(ret); err != nil {
+			return fmt.Errorf("scan fail: %v", err)
+		}
+		scanned++
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("query fail: %v", err)
+	}
+	return nil
+}
+
 // 是否存在记录
 func (m *Model) Exist() bool {
+	m = m.clone()
 	m.builder.fields = []SqlField{}
 
 	if m.schema.TableName == "" {
 		return false
 	}
+	if err := m.emitBefore(EventQueryBefore, "exist"); err != nil {
+		return false
+	}
 	db := m.db
 	m.builder.p = "select"
 	sqlStr, bindParams := m.builder.ToString()
 	// sqlStr := fmt.Sprintf("SELECT * FROM %s WHERE id=?", m.table)
+	start := time.Now()
+	var err error
+	defer func() {
+		db.observeQuery("exist", start, err)
+	}()
 
-	stmt, err := db.Prepare(sqlStr)
+	stmt, err := db.prepareRead(sqlStr, m.usePrimary)
 	if err != nil {
 		return false
 	}
@@ -319,51 +763,102 @@ func (m *Model) Exist() bool {
 // 统计
 func (m *Model) Count() (int64, error) {
 	var dst int64
+	m = m.clone()
 	m.builder.fields = []SqlField{}
 	m.builder.AddFieldRaw("COUNT(*) AS __COUNT__")
-	c := m.Value("__COUNT__", &dst)
+	c := m.value("count", "__COUNT__", &dst)
 	return dst, c.Error
 }
 
 // 求和
 func (m *Model) Sum(col string, dst interface{}) error {
+	m = m.clone()
 	m.builder.fields = []SqlField{}
 	p := utils.ParseField(m.db.dbConf.Driver, m.schema.Type, col, true)
 	m.builder.AddFieldRaw(fmt.Sprintf("SUM(%s) AS __SUM__", p))
-	c := m.Value("__SUM__", dst)
+	c := m.value("sum", "__SUM__", dst)
 	return c.Error
 }
 
 // 最大值
 func (m *Model) Max(col string, dst interface{}) error {
+	m = m.clone()
 	m.builder.fields = []SqlField{}
 	p := utils.ParseField(m.db.dbConf.Driver, m.schema.Type, col, true)
 	m.builder.AddFieldRaw(fmt.Sprintf("MAX(%s) AS __VALUE__", p))
-	c := m.Value("__VALUE__", dst)
+	c := m.value("max", "__VALUE__", dst)
 	return c.Error
 }
 
 // 最小值
 func (m *Model) Min(col string, dst interface{}) error {
+	m = m.clone()
 	m.builder.fields = []SqlField{}
 	p := utils.ParseField(m.db.dbConf.Driver, m.schema.Type, col, true)
 	m.builder.AddFieldRaw(fmt.Sprintf("MIN(%s) AS __VALUE__", p))
-	c := m.Value("__VALUE__", dst)
+	c := m.value("min", "__VALUE__", dst)
 	return c.Error
 }
 
 // 平均值
 func (m *Model) Avg(col string, dst *float64) error {
+	m = m.clone()
 	m.builder.fields = []SqlField{}
 	p := utils.ParseField(m.db.dbConf.Driver, m.schema.Type, col, true)
 	m.builder.AddFieldRaw(fmt.Sprintf("AVG(%s) AS __VALUE__", p))
-	c := m.Value("__VALUE__", dst)
+	c := m.value("avg", "__VALUE__", dst)
 	return c.Error
 }
 
 // 创建
 func (m *Model) Create() error {
+	m = m.instance()
+	_, err := m.insert("insert", nil)
+	return err
+}
+
+// 插入数据, 与主键或唯一索引冲突时更新fields字段, 未指定时更新主键以外的全部列
+// 生成ON DUPLICATE KEY UPDATE, 目前仅支持mysql
+func (m *Model) Upsert(fields ...string) error {
+	m = m.instance()
+	_, err := m.insert("upsert", &upsertClause{
+		conflict: m.schema.PrimaryKeys,
+		updates:  m.upsertFields(m.schema.PrimaryKeys, fields),
+	})
+	return err
+}
+
+// 冲突时更新的字段, 未指定时为冲突字段以外的全部列, 存在更新时间字段时一并更新
+func (m *Model) upsertFields(conflict []string, fields []string) []string {
+	if len(fields) == 0 {
+		for _, f := range m.schema.Fields {
+			if f.DataType == "" || f.AutoIncrement || f == m.schema.AutoCreateTime || utils.InStrArray(conflict, f.Name) {
+				continue
+			}
+			fields = append(fields, f.Name)
+		}
+		return fields
+	}
+	if f := m.schema.AutoUpdateTime; f != nil && !utils.InStrArray(fields, f.Name) {
+		fields = append(fields, f.Name)
+	}
+	return fields
+}
+
+// 执行插入, upsert不为空时附加冲突处理, 返回影响行数
+func (m *Model) insert(action string, upsert *upsertClause) (affected int64, err error) {
 	db := m.db
+	if upsert != nil && db.dbConf.Driver != "mysql" {
+		return 0, fmt.Errorf("upsert is not supported by %s", db.dbConf.Driver)
+	}
+	if err := m.callHook(hookBeforeCreate); err != nil {
+		return 0, err
+	}
+	// 插入前回调可调整冲突处理(如多租户限制更新范围)
+	m.builder.upsert = upsert
+	if err := m.emitBefore(EventInsertBefore, "insert"); err != nil {
+		return 0, err
+	}
 	m.builder.p = "insert"
 	fieldNum := len(m.schema.Fields)
 	m.builder.data = make(map[string]interface{}, fieldNum)
@@ -371,11 +866,28 @@ func (m *Model) Create() error {
 		field := m.schema.Fields[i]
 		m.builder.data[field.Name] = m.schema.GetFieldValue(field.Name)
 	}
+	if field := m.schema.Version; field != nil && reflect.ValueOf(m.builder.data[field.Name]).IsZero() {
+		value := field.NextVersion(m.builder.data[field.Name])
+		if fieldValue := m.schema.GetStructValue(field.Name); fieldValue.CanSet() {
+			fieldValue.Set(value)
+		}
+		m.builder.data[field.Name] = value.Interface()
+	}
+	now := time.Now()
+	for _, field := range []*schema.Field{m.schema.AutoCreateTime, m.schema.AutoUpdateTime} {
+		if field != nil && reflect.ValueOf(m.builder.data[field.Name]).IsZero() {
+			m.builder.data[field.Name] = m.schema.SetFieldTime(field, now)
+		}
+	}
 	sqlStr, bindParams := m.builder.ToString()
+	start := time.Now()
+	defer func() {
+		db.observeQuery(action, start, err)
+	}()
 
 	stmt, err := db.Prepare(sqlStr)
 	if err != nil {
-		return fmt.Errorf("prepare fail: %v", err)
+		return 0, fmt.Errorf("prepare fail: %v", err)
 	}
 	defer stmt.Close()
 
@@ -384,46 +896,84 @@ func (m *Model) Create() error {
 	if m.db.dbConf.Driver == "mssql" {
 		result, err := stmt.Query(bindParams...)
 		if err != nil {
-			return fmt.Errorf("insert exec fail: %v", err)
+			return 0, fmt.Errorf("insert exec fail: %v", err)
 		}
 
 		if result.Next() {
 			_ = result.Scan(&lastId)
 		}
+		_ = result.Close()
+		affected = 1
 	} else {
 		result, err := stmt.Exec(bindParams...)
 		if err != nil {
-			return fmt.Errorf("insert exec fail: %v", err)
+			return 0, fmt.Errorf("insert exec fail: %v", err)
 		}
 
 		lastId, err = result.LastInsertId()
 		if err != nil {
-			return fmt.Errorf("insert getLastInsertId fail: %v", err)
+			return 0, fmt.Errorf("insert getLastInsertId fail: %v", err)
+		}
+		if affected, err = result.RowsAffected(); err != nil {
+			return 0, fmt.Errorf("insert getRowsAffected fail: %v", err)
 		}
 	}
 
-	err = m.schema.SetFieldValue(m.schema.PrimaryKey, lastId)
-	if err != nil {
-		return err
+	// upsert未插入新行时数据库可能不返回自增id
+	if !m.schema.IsCompositeKey() && (upsert == nil || lastId > 0) {
+		err = m.schema.SetFieldValue(m.schema.PrimaryKey, lastId)
+		if err != nil {
+			return affected, err
+		}
 	}
-	err = m.context.emitEvent("insert_after", &CallbackParams{
+	err = m.context.emitEvent(EventInsertAfter, &CallbackParams{
 		Action: "insert",
 		Model:  m,
 	})
-	return err
+	if err != nil {
+		return affected, err
+	}
+	return affected, m.callHook(hookAfterCreate)
 }
 
 // 修改
-func (m *Model) Update() error {
+func (m *Model) Update() (err error) {
+	// 主键、版本等条件只用于本次执行, 同一模型多次更新不会累积条件
+	m = m.clone()
 	db := m.db
+	if err := m.callHook(hookBeforeUpdate); err != nil {
+		return err
+	}
+	if err := m.emitBefore(EventUpdateBefore, "update"); err != nil {
+		return err
+	}
 	m.builder.p = "update"
-	m.builder.data = utils.StructToMap(m.model)
-	if m.builder.where == nil {
-		if pkValue := m.schema.GetFieldValue(m.schema.PrimaryKey); pkValue != nil {
-			m.Where(m.schema.PrimaryKey, pkValue)
+	m.builder.data = make(map[string]interface{}, len(m.schema.Fields))
+	for _, field := range m.schema.Fields {
+		m.builder.data[field.Name] = m.schema.GetFieldValue(field.Name)
+	}
+	if field := m.schema.AutoUpdateTime; field != nil {
+		m.builder.data[field.Name] = m.schema.SetFieldTime(field, time.Now())
+		if len(m.builder.fields) > 0 && !m.builder.hasField(field.Name) {
+			m.builder.AddField(field.Name)
+		}
+	}
+	m.wherePrimaryKey()
+	var version reflect.Value
+	if field := m.schema.Version; field != nil {
+		current := m.schema.GetFieldValue(field.Name)
+		m.builder.AddScope(field.Name, current)
+		version = field.NextVersion(current)
+		m.builder.data[field.Name] = version.Interface()
+		if len(m.builder.fields) > 0 && !m.builder.hasField(field.Name) {
+			m.builder.AddField(field.Name)
 		}
 	}
 	sqlStr, bindParams := m.builder.ToString()
+	start := time.Now()
+	defer func() {
+		db.observeQuery("update", start, err)
+	}()
 
 	stmt, err := db.Prepare(sqlStr)
 	if err != nil {
@@ -436,29 +986,122 @@ func (m *Model) Update() error {
 		return fmt.Errorf("query fail: %v", err)
 	}
 
-	_, err = result.RowsAffected()
+	affected, err := result.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("update fail: %v", err)
 	}
-	err = m.context.emitEvent("update_after", &CallbackParams{
+	if version.IsValid() {
+		if affected == 0 {
+			return ErrStaleObject
+		}
+		if fieldValue := m.schema.GetStructValue(m.schema.Version.Name); fieldValue.CanSet() {
+			fieldValue.Set(version)
+		}
+	}
+	err = m.context.emitEvent(EventUpdateAfter, &CallbackParams{
 		Action: "update",
 		Model:  m,
 	})
+	if err != nil {
+		return err
+	}
+	return m.callHook(hookAfterUpdate)
+}
 
-	return err
+// 按字段名更新指定列, 存在更新时间字段时一并更新
+func (m *Model) UpdateColumns(values map[string]interface{}) error {
+	m = m.clone()
+	if len(values) == 0 {
+		return errors.New("update columns is empty")
+	}
+	if err := m.fillAttrs(values); err != nil {
+		return err
+	}
+	for _, k := range utils.SortedKeys(values) {
+		m.Field(k)
+	}
+	return m.Update()
+}
+
+// 调用操作前事件
+func (m *Model) emitBefore(event string, action string) error {
+	if m.err != nil {
+		return m.err
+	}
+	return m.context.emitEvent(event, &CallbackParams{
+		Action: action,
+		Model:  m,
+	})
 }
 
-// 删除
+// 未设置条件时使用主键作为条件
+func (m *Model) wherePrimaryKey() {
+	if m.builder.where == nil && !m.pkScoped {
+		for _, pk := range m.schema.PrimaryKeys {
+			if pkValue := m.schema.GetFieldValue(pk); pkValue != nil {
+				m.Where(pk, pkValue)
+			}
+		}
+	}
+}
+
+// 删除, 存在软删除字段时仅标记删除时间
 func (m *Model) Delete() error {
+	m = m.instance()
+	if err := m.callHook(hookBeforeDelete); err != nil {
+		return err
+	}
+	if err := m.deleteWith("delete", m.deleteExec); err != nil {
+		return err
+	}
+	return m.callHook(hookAfterDelete)
+}
+
+// 按主键列表删除, 列表较大时分批删除
+// 模型中没有被删除的数据, 因此不调用模型的删除钩子, 也不级联删除关联数据
+func (m *Model) DeleteByPk(ids ...interface{}) error {
+	m = m.instance()
+	if len(ids) == 0 {
+		return nil
+	}
+	return m.deleteWith("delete_by_pk", func() error {
+		return m.eachPkChunk(ids, m.deleteExec)
+	})
+}
+
+// 执行软删除或物理删除
+func (m *Model) deleteExec() error {
+	if m.schema.SoftDelete != nil && !m.forceDelete {
+		return m.updateSoftDelete("delete", m.schema.SoftDelete.TimeValue(time.Now()))
+	}
+	return m.deleteRows()
+}
+
+// 调用删除前后的事件
+func (m *Model) deleteWith(action string, exec func() error) error {
+	if err := m.emitBefore(EventDeleteBefore, action); err != nil {
+		return err
+	}
+	if err := exec(); err != nil {
+		return err
+	}
+	return m.context.emitEvent(EventDeleteAfter, &CallbackParams{
+		Action: action,
+		Model:  m,
+	})
+}
+
+// 执行删除语句
+func (m *Model) deleteRows() (err error) {
 	db := m.db
 	m.builder.p = "delete"
 
-	if m.builder.where == nil {
-		if pkValue := m.schema.GetFieldValue(m.schema.PrimaryKey); pkValue != nil {
-			m.Where(m.schema.PrimaryKey, pkValue)
-		}
-	}
+	m.wherePrimaryKey()
 	sqlStr, bindParams := m.builder.ToString()
+	start := time.Now()
+	defer func() {
+		db.observeQuery("delete", start, err)
+	}()
 
 	stmt, err := db.Prepare(sqlStr)
 	if err != nil {
@@ -475,10 +1118,53 @@ func (m *Model) Delete() error {
 	if err != nil {
 		return fmt.Errorf("delete fail: %v", err)
 	}
-	err = m.context.emitEvent("delete_after", &CallbackParams{
-		Action: "delete",
-		Model:  m,
-	})
+	return nil
+}
 
-	return err
+// 忽略软删除, 直接删除
+func (m *Model) ForceDelete() error {
+	m = m.instance()
+	m.forceDelete = true
+	return m.Delete()
+}
+
+// 恢复软删除的数据
+func (m *Model) Restore() error {
+	m = m.instance()
+	if m.schema.SoftDelete == nil {
+		return fmt.Errorf("model %s has no soft delete field", m.schema.Type.Name())
+	}
+	if err := m.emitBefore(EventUpdateBefore, "restore"); err != nil {
+		return err
+	}
+	return m.updateSoftDelete("restore", reflect.Zero(m.schema.SoftDelete.FieldType))
+}
+
+// 更新软删除字段
+func (m *Model) updateSoftDelete(action string, value reflect.Value) (err error) {
+	db := m.db
+	field := m.schema.SoftDelete
+	m.builder.p = "update"
+	m.builder.fields = []SqlField{{Name: field.Name}}
+	m.builder.data = map[string]interface{}{field.Name: value.Interface()}
+	m.wherePrimaryKey()
+	sqlStr, bindParams := m.builder.ToString()
+	start := time.Now()
+	defer func() {
+		db.observeQuery(action, start, err)
+	}()
+
+	stmt, err := db.Prepare(sqlStr)
+	if err != nil {
+		return fmt.Errorf("prepare fail: %v", err)
+	}
+	defer stmt.Close()
+
+	if _, err = stmt.Exec(bindParams...); err != nil {
+		return fmt.Errorf("query fail: %v", err)
+	}
+	if fieldValue := m.schema.GetStructValue(field.Name); fieldValue.CanSet() {
+		fieldValue.Set(value)
+	}
+	return nil
 }
@@ -0,0 +1,246 @@
+package korm
+
+import (
+	"database/sql/driver"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// 测试按主键列表分批查询
+func TestFindMany(t *testing.T) {
+	table := setFakeTable("many", []string{"id", "user"}, [][]driver.Value{{int64(1), []byte("a")}, {int64(2), []byte("b")}})
+	ids := make([]int64, pkChunkSize*2+1)
+	for i := range ids {
+		ids[i] = int64(i + 1)
+	}
+	var rows []TestBench
+	coll := newFakeModel("many", &rows).FindMany(ids)
+	assert.NoError(t, coll.Error)
+	assert.True(t, coll.Exist)
+	assert.Len(t, table.queries, 3)
+	assert.Equal(t, pkChunkSize, strings.Count(table.queries[0], "?"))
+	assert.Equal(t, 1, strings.Count(table.queries[2], "?"))
+	assert.Len(t, rows, 6)
+	assert.Len(t, coll.Data, 6)
+
+	var row TestBench
+	setFakeTable("many", []string{"id", "user"}, nil)
+	err := newFakeModel("many", &row).FirstOrFail(1)
+	assert.True(t, IsRecordNotFound(err))
+
+	// 同一模型多次按主键查询, 主键条件不会累积
+	table = setFakeTable("many", []string{"id", "user"}, nil)
+	m := newFakeModel("many", &row)
+	m.Find(1)
+	m.FindByPk(2)
+	assert.Equal(t, table.queries[0], table.queries[1])
+	assert.Equal(t, "SELECT `id`,`user`,`score`,`remark`,`create_time`,`update_time` FROM `test_bench` WHERE `id`=?", table.queries[1])
+	assert.Equal(t, []driver.Value{int64(2)}, table.args[1])
+	assert.Nil(t, m.builder.where)
+	assert.Nil(t, m.builder.scope)
+}
+
+type TestHookDelete struct {
+	Id int64 `db:"id"`
+}
+
+func (t *TestHookDelete) BeforeDelete(ctx *Context) error {
+	return errors.New("hook called")
+}
+
+// 测试按主键列表删除
+func TestDeleteByPk(t *testing.T) {
+	table := setFakeTable("delete", nil, nil)
+	assert.NoError(t, newFakeModel("delete", &TestBench{Id: 9}).DeleteByPk(1, 2, 3))
+	assert.Equal(t, []string{"DELETE FROM `test_bench` WHERE `id` in(?,?,?)"}, table.queries)
+
+	// 不调用绑定模型的删除钩子
+	assert.NoError(t, newFakeModel("delete", &TestHookDelete{Id: 9}).DeleteByPk(1))
+	assert.Equal(t, "DELETE FROM `test_hook_delete` WHERE `id` in(?)", table.queries[1])
+
+	sqlStr, params := buildSql(newTestModel(&TestUserRole{}).Where("Remark", "a"), "select")
+	assert.Equal(t, "SELECT `user_id`,`role_id`,`remark` FROM `test_user_role` WHERE `remark`=?", sqlStr)
+	assert.Equal(t, []interface{}{"a"}, params)
+	m := newTestModel(&TestUserRole{})
+	m.builder.AddScopePkIn([]interface{}{[]int{1, 2}})
+	sqlStr, params = buildSql(m, "delete")
+	assert.Equal(t, "DELETE FROM `test_user_role` WHERE ((`user_id`=? and `role_id`=?))", sqlStr)
+	assert.Equal(t, []interface{}{1, 2}, params)
+}
+
+// 测试查询不存在时创建
+func TestFirstOrCreate(t *testing.T) {
+	table := setFakeTable("first", []string{"id", "user"}, nil)
+	var row TestBench
+	coll := newFakeModel("first", &row).FirstOrCreate(map[string]interface{}{"User": "a"}, map[string]interface{}{"Score": 2.5})
+	assert.NoError(t, coll.Error)
+	assert.False(t, coll.Exist)
+	assert.Equal(t, TestBench{Id: 1, User: "a", Score: 2.5, CreateTime: row.CreateTime, UpdateTime: row.UpdateTime}, row)
+	assert.Len(t, table.queries, 2)
+	assert.True(t, strings.HasPrefix(table.queries[1], "INSERT INTO `test_bench`"))
+	assert.True(t, strings.HasSuffix(table.queries[1], " ON DUPLICATE KEY UPDATE `id`=LAST_INSERT_ID(`id`)"))
+
+	// 并发创建时upsert未插入新行, 返回已存在的记录
+	table = setFakeTable("first", []string{"id", "user"}, nil)
+	table.pages = []fakePage{{}, {rows: [][]driver.Value{{int64(7), []byte("a")}}}}
+	table.results = []int64{0}
+	row = TestBench{}
+	coll = newFakeModel("first", &row).FirstOrCreate(map[string]interface{}{"User": "a"})
+	assert.NoError(t, coll.Error)
+	assert.True(t, coll.Exist)
+	assert.Equal(t, int64(7), row.Id)
+	assert.Len(t, table.queries, 3)
+
+	table = setFakeTable("first", []string{"id", "user"}, [][]driver.Value{{int64(5), []byte("a")}})
+	row = TestBench{}
+	coll = newFakeModel("first", &row).UpdateOrCreate(map[string]interface{}{"User": "a"}, map[string]interface{}{"Score": 3.0})
+	assert.NoError(t, coll.Error)
+	assert.True(t, coll.Exist)
+	assert.Equal(t, int64(5), row.Id)
+	assert.Equal(t, 3.0, row.Score)
+	assert.Equal(t, "UPDATE `test_bench` SET `score`=?,`update_time`=? WHERE `id`=?", table.queries[1])
+
+	table = setFakeTable("first", []string{"id", "user"}, nil)
+	row = TestBench{}
+	coll = newFakeModel("first", &row).UpdateOrCreate(map[string]interface{}{"User": "b"}, map[string]interface{}{"Score": 4.0})
+	assert.NoError(t, coll.Error)
+	assert.False(t, coll.Exist)
+	assert.Equal(t, 4.0, row.Score)
+	assert.True(t, strings.HasSuffix(table.queries[1], " ON DUPLICATE KEY UPDATE `id`=LAST_INSERT_ID(`id`),`score`=VALUES(`score`),`update_time`=VALUES(`update_time`)"))
+
+	// 属性条件不会留在模型上
+	table = setFakeTable("first", []string{"id", "user"}, [][]driver.Value{{int64(5), []byte("a")}})
+	m := newFakeModel("first", &row)
+	m.FirstOrNew(map[string]interface{}{"User": "a"})
+	m.FirstOrNew(map[string]interface{}{"User": "b"})
+	assert.Equal(t, table.queries[0], table.queries[1])
+	assert.Equal(t, []driver.Value{"b"}, table.args[1])
+	assert.Nil(t, m.builder.scope)
+}
+
+// 测试按类型获取一列数据
+func TestPluck(t *testing.T) {
+	table := setFakeTable("pluck", []string{"id", "user"}, [][]driver.Value{{int64(1), []byte("a")}, {int64(2), nil}})
+	var ids []int64
+	assert.NoError(t, newFakeModel("pluck", &TestBench{}).Where("Score", ">", 1).Pluck("Id", &ids))
+	assert.Equal(t, []int64{1, 2}, ids)
+	assert.Equal(t, "SELECT `id` FROM `test_bench` WHERE `score`>?", table.queries[0])
+
+	var users map[int64]*string
+	assert.NoError(t, newFakeModel("pluck", &TestBench{}).PluckMap("Id", "User", &users))
+	assert.Equal(t, "a", *users[1])
+	assert.Nil(t, users[2])
+
+	var names []int
+	assert.Error(t, newFakeModel("pluck", &TestBench{}).Pluck("User", &names))
+	assert.Error(t, newFakeModel("pluck", &TestBench{}).Pluck("User", names))
+}
+
+// 测试按主键分批查询
+func TestChunk(t *testing.T) {
+	table := setFakeTable("chunk", []string{"id", "user"}, nil)
+	table.pages = []fakePage{
+		{rows: [][]driver.Value{{int64(1), []byte("a")}, {int64(2), []byte("b")}}},
+		{rows: [][]driver.Value{{int64(3), []byte("c")}}},
+	}
+	var rows []TestBench
+	ids := make([]int64, 0)
+	m := newFakeModel("chunk", &rows).Where("Score", ">", 1)
+	err := m.Chunk(2, func(batch interface{}) error {
+		for _, row := range *batch.(*[]TestBench) {
+			ids = append(ids, row.Id)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3}, ids)
+	assert.Len(t, table.queries, 2)
+	assert.Equal(t, "SELECT `id`,`user`,`score`,`remark`,`create_time`,`update_time` FROM `test_bench` WHERE (`score`>?) AND (`id`>?) ORDER BY `id` ASC LIMIT 2", table.queries[1])
+	assert.Equal(t, []driver.Value{int64(1), int64(2)}, table.args[1])
+	// 调用方模型的条件不变
+	assert.Nil(t, m.builder.orders)
+	assert.Nil(t, m.builder.limit)
+	assert.Nil(t, m.builder.scope)
+
+	err = m.OrderByDesc("Score").Chunk(2, func(batch interface{}) error {
+		return nil
+	})
+	assert.EqualError(t, err, "chunk orders by primary key, remove the custom order")
+	assert.Len(t, table.queries, 2)
+}
+
+// 测试游标逐行读取
+func TestCursor(t *testing.T) {
+	setFakeTable("cursor", []string{"id", "user"}, [][]driver.Value{{int64(1), []byte("a")}, {int64(2), []byte("b")}})
+	cursor, err := newFakeModel("cursor", &TestBench{}).Cursor()
+	assert.NoError(t, err)
+	users := make([]string, 0)
+	for cursor.Next() {
+		var row TestBench
+		assert.NoError(t, cursor.Scan(&row))
+		users = append(users, row.User)
+	}
+	assert.NoError(t, cursor.Err())
+	assert.NoError(t, cursor.Close())
+	assert.Equal(t, []string{"a", "b"}, users)
+
+	m := newFakeModel("cursor", &TestBench{})
+	rows, err := m.Rows()
+	assert.NoError(t, err)
+	defer rows.Close()
+	assert.True(t, rows.Next())
+	var row TestBench
+	assert.NoError(t, m.ScanRow(rows, &row))
+	assert.Equal(t, int64(1), row.Id)
+	assert.Error(t, m.ScanRow(rows, row))
+}
+
+// 测试会话模式重复使用查询条件
+func TestSession(t *testing.T) {
+	table := setFakeTable("session", []string{"id", "user"}, [][]driver.Value{{int64(1), []byte("a")}})
+	table.pages = []fakePage{{columns: []string{"__COUNT__"}, rows: [][]driver.Value{{int64(1)}}}}
+	var rows []TestBench
+	m := newFakeModel("session", &rows).Where("Score", ">", 1).Session()
+	total, err := m.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.NoError(t, m.Clone().Limit(5).Select().Error)
+	assert.NoError(t, m.Select().Error)
+	assert.Len(t, rows, 1)
+	assert.Equal(t, "SELECT `id`,`user`,`score`,`remark`,`create_time`,`update_time` FROM `test_bench` WHERE `score`>?", table.queries[2])
+	assert.Equal(t, table.queries[2]+" LIMIT 5", table.queries[1])
+	assert.Equal(t, []driver.Value{int64(1)}, table.args[2])
+	assert.Empty(t, m.builder.p)
+	assert.Nil(t, m.builder.limit)
+
+	c := m.Clone().Where("Id", 2)
+	assert.Len(t, c.builder.where.list, 2)
+	assert.Len(t, m.builder.where.list, 1)
+
+	// 非会话模式下聚合查询也不影响字段设置
+	n := newFakeModel("session", &TestBench{}).Field("Id")
+	_, _ = n.Count()
+	sqlStr, params := buildSql(n.Where("Id", 1), "select")
+	assert.Equal(t, "SELECT `id` FROM `test_bench` WHERE `id`=?", sqlStr)
+	_, params = n.builder.ToString()
+	assert.Equal(t, []interface{}{1}, params)
+}
+
+// 测试按主键冲突更新
+func TestUpsert(t *testing.T) {
+	table := setFakeTable("upsert", nil, nil)
+	role := &TestUserRole{UserId: 1, RoleId: 2, Remark: "admin"}
+	assert.NoError(t, newFakeModel("upsert", role).Upsert())
+	assert.Equal(t, "INSERT INTO `test_user_role` (`user_id`,`role_id`,`remark`) VALUES (?,?,?) ON DUPLICATE KEY UPDATE `remark`=VALUES(`remark`)", table.queries[0])
+
+	row := &TestBench{Id: 5, User: "a"}
+	assert.NoError(t, UseContext("upsert").Model(row).Upsert("User"))
+	assert.Equal(t, "INSERT INTO `test_bench` (`id`,`user`,`score`,`remark`,`create_time`,`update_time`) VALUES (?,?,?,?,?,?)"+
+		" ON DUPLICATE KEY UPDATE `id`=LAST_INSERT_ID(`id`),`user`=VALUES(`user`),`update_time`=VALUES(`update_time`)", table.queries[1])
+
+	m := newFakeModel("upsert", role)
+	m.db.dbConf.Driver = "mssql"
+	assert.EqualError(t, m.Upsert(), "upsert is not supported by mssql")
+}
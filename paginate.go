@@ -0,0 +1,294 @@
+package korm
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/wdaglb/korm/schema"
+	"github.com/wdaglb/korm/utils"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 未指定每页数量时的默认值
+const defaultPerPage = 15
+
+// 分页结果
+type Pagination struct {
+	Total       int64       `json:"total"`
+	PerPage     int         `json:"per_page"`
+	CurrentPage int         `json:"current_page"`
+	LastPage    int         `json:"last_page"`
+	Items       interface{} `json:"items"`
+}
+
+// 分页查询, 总数与数据分别在模型副本上查询, dst为切片指针
+func (m *Model) Paginate(page int, perPage int, dst interface{}) (*Pagination, error) {
+	if page < 1 {
+		page = 1
+	}
+	if perPage <= 0 {
+		perPage = defaultPerPage
+	}
+
+	counter := m.clone()
+	counter.withList = make(map[string]WithCond)
+	counter.builder.orders = nil
+	counter.builder.offset = nil
+	counter.builder.limit = nil
+	total, err := counter.Count()
+	if err != nil && !IsRecordNotFound(err) {
+		return nil, err
+	}
+
+	pagination := &Pagination{
+		Total:       total,
+		PerPage:     perPage,
+		CurrentPage: page,
+		LastPage:    int((total + int64(perPage) - 1) / int64(perPage)),
+		Items:       dst,
+	}
+	if pagination.LastPage < 1 {
+		pagination.LastPage = 1
+	}
+
+	list := m.clone()
+	if err = list.setData(dst); err != nil {
+		return nil, err
+	}
+	// 未指定排序时按主键排序, mssql的OFFSET必须带有ORDER BY
+	if len(list.builder.orders) == 0 {
+		list.OrderByAsc(list.schema.PrimaryKeys...)
+	}
+	list.Offset((page - 1) * perPage)
+	list.Limit(perPage)
+	if total > 0 {
+		if err = list.Select().Error; err != nil {
+			return nil, err
+		}
+	}
+	return pagination, nil
+}
+
+// 替换模型的数据目标, dst为与模型同类型的切片指针
+func (m *Model) setData(dst interface{}) error {
+	value := utils.Indirect(reflect.ValueOf(dst))
+	if value.Kind() != reflect.Slice || !value.CanSet() || value.Type().Elem() != m.schema.Type {
+		return fmt.Errorf("dst must be *[]%s", m.schema.Type.Name())
+	}
+	s := *m.schema
+	s.Data = value
+	m.schema = &s
+	m.builder.schema = &s
+	m.model = dst
+	return nil
+}
+
+const (
+	cursorNext = "next" // 向后翻页
+	cursorPrev = "prev" // 向前翻页
+)
+
+// 游标分页结果, 游标为空表示没有更多数据
+type CursorPagination struct {
+	PerPage    int         `json:"per_page"`
+	NextCursor string      `json:"next_cursor"`
+	PrevCursor string      `json:"prev_cursor"`
+	Items      interface{} `json:"items"`
+}
+
+// 游标内容, 记录翻页方向及边界行的排序字段值
+type cursorToken struct {
+	Direction string        `json:"d"`
+	Values    []cursorValue `json:"v"`
+}
+
+// 带类型的驱动值, 保证解码后与编码前类型一致
+type cursorValue struct {
+	Type  string      `json:"t"`
+	Value interface{} `json:"v"`
+}
+
+// 游标分页, 按orderFields排序, 字段前加-表示倒序, 未包含主键时追加主键保证顺序唯一
+// 数据写入模型的切片, cursor为空时查询第一页
+func (m *Model) CursorPaginate(cursor string, limit int, orderFields ...string) (*CursorPagination, error) {
+	m = m.instance()
+	if !m.schema.IsArray() {
+		return nil, errors.New("cursor paginate dst must be a slice pointer")
+	}
+	if limit <= 0 {
+		limit = defaultPerPage
+	}
+	fields, desc, err := m.cursorOrder(orderFields)
+	if err != nil {
+		return nil, err
+	}
+	token := &cursorToken{Direction: cursorNext}
+	if cursor != "" {
+		if token, err = decodeCursor(cursor, len(fields)); err != nil {
+			return nil, err
+		}
+	}
+
+	// 向前翻页时反转排序, 查询后再恢复顺序
+	reverse := token.Direction == cursorPrev
+	queryDesc := make([]bool, len(desc))
+	for i := range desc {
+		queryDesc[i] = desc[i] != reverse
+	}
+	if len(token.Values) > 0 {
+		values := make([]interface{}, len(token.Values))
+		for i, v := range token.Values {
+			values[i] = v.driverValue()
+		}
+		m.builder.AddScopeSeek(fields, queryDesc, values)
+	}
+	m.builder.orders = nil
+	for i, f := range fields {
+		if queryDesc[i] {
+			m.OrderByDesc(f)
+		} else {
+			m.OrderByAsc(f)
+		}
+	}
+	m.Limit(limit + 1)
+	m.schema.Data.Set(reflect.MakeSlice(m.schema.Data.Type(), 0, limit+1))
+	if err = m.Select().Error; err != nil {
+		return nil, err
+	}
+
+	data := m.schema.Data
+	hasMore := data.Len() > limit
+	if hasMore {
+		data.Set(data.Slice(0, limit))
+	}
+	if reverse {
+		swap := reflect.Swapper(data.Interface())
+		for i, j := 0, data.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+
+	pagination := &CursorPagination{PerPage: limit, Items: m.model}
+	if data.Len() == 0 {
+		return pagination, nil
+	}
+	// 向后翻页时是否有下一页取决于多查出的一行, 向前翻页时来源页即为下一页
+	if hasMore || reverse {
+		if pagination.NextCursor, err = encodeCursor(cursorNext, data.Index(data.Len()-1), m.schema, fields); err != nil {
+			return nil, err
+		}
+	}
+	if (hasMore && reverse) || (!reverse && len(token.Values) > 0) {
+		if pagination.PrevCursor, err = encodeCursor(cursorPrev, data.Index(0), m.schema, fields); err != nil {
+			return nil, err
+		}
+	}
+	return pagination, nil
+}
+
+// 解析排序字段, 返回字段名及是否倒序
+func (m *Model) cursorOrder(orderFields []string) ([]string, []bool, error) {
+	fields := make([]string, 0, len(orderFields)+len(m.schema.PrimaryKeys))
+	desc := make([]bool, 0, cap(fields))
+	for _, f := range orderFields {
+		isDesc := strings.HasPrefix(f, "-")
+		f = strings.TrimPrefix(f, "-")
+		if m.schema.FieldNames[f] == nil {
+			return nil, nil, fmt.Errorf("order field %s not found in %s", f, m.schema.Type.Name())
+		}
+		fields = append(fields, f)
+		desc = append(desc, isDesc)
+	}
+	for _, pk := range m.schema.PrimaryKeys {
+		if utils.InStrArray(fields, pk) {
+			continue
+		}
+		isDesc := len(desc) > 0 && desc[len(desc)-1]
+		fields = append(fields, pk)
+		desc = append(desc, isDesc)
+	}
+	return fields, desc, nil
+}
+
+// 按行的排序字段值生成游标
+func encodeCursor(direction string, row reflect.Value, s *schema.Schema, fields []string) (string, error) {
+	token := cursorToken{Direction: direction}
+	for _, f := range fields {
+		value, err := driver.DefaultParameterConverter.ConvertValue(row.FieldByIndex(s.FieldNames[f].StructField.Index).Interface())
+		if err != nil {
+			return "", fmt.Errorf("cursor value %s fail: %v", f, err)
+		}
+		token.Values = append(token.Values, newCursorValue(value))
+	}
+	data, err := json.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// 解析游标, 字段数量与排序字段不一致时视为无效
+func decodeCursor(cursor string, size int) (*cursorToken, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	token := &cursorToken{}
+	if err = decoder.Decode(token); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if (token.Direction != cursorNext && token.Direction != cursorPrev) || len(token.Values) != size {
+		return nil, ErrInvalidCursor
+	}
+	return token, nil
+}
+
+func newCursorValue(value driver.Value) cursorValue {
+	switch v := value.(type) {
+	case int64:
+		return cursorValue{Type: "int", Value: v}
+	case float64:
+		return cursorValue{Type: "float", Value: v}
+	case bool:
+		return cursorValue{Type: "bool", Value: v}
+	case []byte:
+		return cursorValue{Type: "bytes", Value: v}
+	case time.Time:
+		return cursorValue{Type: "time", Value: v.Format(time.RFC3339Nano)}
+	case nil:
+		return cursorValue{Type: "null"}
+	}
+	return cursorValue{Type: "string", Value: fmt.Sprintf("%v", value)}
+}
+
+// 还原为绑定参数
+func (v cursorValue) driverValue() interface{} {
+	str := fmt.Sprintf("%v", v.Value)
+	switch v.Type {
+	case "int":
+		i, _ := strconv.ParseInt(str, 10, 64)
+		return i
+	case "float":
+		f, _ := strconv.ParseFloat(str, 64)
+		return f
+	case "bool":
+		return v.Value == true
+	case "bytes":
+		b, _ := base64.StdEncoding.DecodeString(str)
+		return b
+	case "time":
+		t, _ := time.Parse(time.RFC3339Nano, str)
+		return t
+	case "null":
+		return nil
+	}
+	return str
+}
@@ -0,0 +1,102 @@
+package korm
+
+import (
+	"database/sql/driver"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// 测试分页查询
+func TestPaginate(t *testing.T) {
+	table := setFakeTable("page", []string{"id", "user"}, nil)
+	table.pages = []fakePage{
+		{columns: []string{"__COUNT__"}, rows: [][]driver.Value{{int64(45)}}},
+		{rows: [][]driver.Value{{int64(21), []byte("a")}, {int64(22), []byte("b")}}},
+	}
+	m := newFakeModel("page", &TestBench{}).Where("Score", ">", 1).OrderByDesc("Id").Limit(3)
+	var rows []TestBench
+	pagination, err := m.Paginate(3, 10, &rows)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(45), pagination.Total)
+	assert.Equal(t, 5, pagination.LastPage)
+	assert.Equal(t, 3, pagination.CurrentPage)
+	assert.Equal(t, &rows, pagination.Items)
+	assert.Len(t, rows, 2)
+	assert.Equal(t, "SELECT COUNT(*) AS __COUNT__ FROM `test_bench` WHERE `score`>?", table.queries[0])
+	assert.Equal(t, "SELECT `id`,`user`,`score`,`remark`,`create_time`,`update_time` FROM `test_bench` WHERE `score`>? ORDER BY `id` DESC LIMIT 10 OFFSET 20", table.queries[1])
+	assert.Nil(t, m.builder.offset)
+	assert.Equal(t, 3, *m.builder.limit)
+
+	var others []TestSoft
+	_, err = m.Paginate(1, 10, &others)
+	assert.Error(t, err)
+}
+
+// 测试mssql分页的默认排序
+func TestPaginateMssql(t *testing.T) {
+	table := setFakeTable("page_mssql", []string{"id", "user"}, nil)
+	table.pages = []fakePage{
+		{columns: []string{"__COUNT__"}, rows: [][]driver.Value{{int64(45)}}},
+	}
+	m := newFakeModel("page_mssql", &TestBench{})
+	m.db.dbConf.Driver = "mssql"
+	var rows []TestBench
+	_, err := m.Paginate(3, 10, &rows)
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT [id],[user],[score],[remark],[create_time],[update_time] FROM [test_bench] ORDER BY [id] ASC OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY", table.queries[1])
+
+	m = newTestModel(&TestBench{})
+	m.db.dbConf.Driver = "mssql"
+	sqlStr, _ := buildSql(m.OrderByAsc("Id").Offset(20), "select")
+	assert.Equal(t, "SELECT [id],[user],[score],[remark],[create_time],[update_time] FROM [test_bench] ORDER BY [id] ASC OFFSET 20 ROWS", sqlStr)
+}
+
+// 测试游标分页
+func TestCursorPaginate(t *testing.T) {
+	table := setFakeTable("cursor_page", []string{"id", "score"}, nil)
+	table.pages = []fakePage{
+		{rows: [][]driver.Value{{int64(1), 1.5}, {int64(2), 2.5}, {int64(3), 3.5}}},
+		{rows: [][]driver.Value{{int64(3), 3.5}}},
+		{rows: [][]driver.Value{{int64(2), 2.5}, {int64(1), 1.5}}},
+	}
+	var rows []TestBench
+	page, err := newFakeModel("cursor_page", &rows).CursorPaginate("", 2, "Score")
+	assert.NoError(t, err)
+	assert.Len(t, rows, 2)
+	assert.NotEmpty(t, page.NextCursor)
+	assert.Empty(t, page.PrevCursor)
+	assert.Equal(t, "SELECT `id`,`user`,`score`,`remark`,`create_time`,`update_time` FROM `test_bench` ORDER BY `score` ASC, `id` ASC LIMIT 3", table.queries[0])
+
+	page, err = newFakeModel("cursor_page", &rows).CursorPaginate(page.NextCursor, 2, "Score")
+	assert.NoError(t, err)
+	assert.Len(t, rows, 1)
+	assert.Empty(t, page.NextCursor)
+	assert.NotEmpty(t, page.PrevCursor)
+	assert.Equal(t, "SELECT `id`,`user`,`score`,`remark`,`create_time`,`update_time` FROM `test_bench` WHERE ((`score`,`id`) > (?,?)) ORDER BY `score` ASC, `id` ASC LIMIT 3", table.queries[1])
+	assert.Equal(t, []driver.Value{2.5, int64(2)}, table.args[1])
+
+	page, err = newFakeModel("cursor_page", &rows).CursorPaginate(page.PrevCursor, 2, "Score")
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, []int64{rows[0].Id, rows[1].Id})
+	assert.NotEmpty(t, page.NextCursor)
+	assert.Empty(t, page.PrevCursor)
+	assert.Equal(t, "SELECT `id`,`user`,`score`,`remark`,`create_time`,`update_time` FROM `test_bench` WHERE ((`score`,`id`) < (?,?)) ORDER BY `score` DESC, `id` DESC LIMIT 3", table.queries[2])
+
+	_, err = newFakeModel("cursor_page", &rows).CursorPaginate("bad", 2, "Score")
+	assert.Equal(t, ErrInvalidCursor, err)
+}
+
+// 测试mssql及混合排序方向的游标条件
+func TestSeekCondition(t *testing.T) {
+	m := newTestModel(&TestBench{})
+	m.db.dbConf.Driver = "mssql"
+	m.builder.AddScopeSeek([]string{"Score", "Id"}, []bool{false, false}, []interface{}{2.5, 2})
+	sqlStr, params := buildSql(m, "select")
+	assert.Equal(t, "SELECT [id],[user],[score],[remark],[create_time],[update_time] FROM [test_bench] WHERE (([score]>?) or ([score]=? and [id]>?))", sqlStr)
+	assert.Equal(t, []interface{}{2.5, 2.5, 2}, params)
+
+	m = newTestModel(&TestBench{})
+	m.builder.AddScopeSeek([]string{"Score", "Id"}, []bool{true, false}, []interface{}{2.5, 2})
+	sqlStr, _ = buildSql(m, "select")
+	assert.Equal(t, "SELECT `id`,`user`,`score`,`remark`,`create_time`,`update_time` FROM `test_bench` WHERE ((`score`<?) or (`score`=? and `id`>?))", sqlStr)
+}
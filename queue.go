@@ -42,3 +42,9 @@ func (q *Queue) get() interface{} {
 	val := v.Value
 	return val
 }
+
+func (q *Queue) len() int {
+	defer locLock.Unlock()
+	locLock.Lock()
+	return q.data.Len()
+}
@@ -5,19 +5,45 @@ import (
 	"github.com/wdaglb/korm/schema"
 	"github.com/wdaglb/korm/utils"
 	"reflect"
+	"strings"
 )
 
 type WithCond func(db *Model)
 
+// 关联模型, 连接的选择与Context.Model一致, 主模型指定读主库时关联同样读主库
+func (m *Model) relationModel(mod interface{}) *Model {
+	model := m.context.Model(mod)
+	model.usePrimary = m.usePrimary
+	return model
+}
+
 type relation struct {
 	Type string
-	PrimaryKey string
-	ForeignKey string
-	Value interface{}
+	PrimaryKeys []string // 主模型关联列
+	ForeignKeys []string // 关联模型外键字段
+	Values []interface{}
 	Field *schema.Field
 	WithCond WithCond
 }
 
+// 多个关联值拼接为匹配键
+func relationKey(values []interface{}) string {
+	keys := make([]string, 0, len(values))
+	for _, v := range values {
+		keys = append(keys, fmt.Sprintf("%v", v))
+	}
+	return strings.Join(keys, ",")
+}
+
+// 按字段名读取结构值并拼接为匹配键
+func relationValueKey(row reflect.Value, names []string) string {
+	values := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		values = append(values, row.FieldByName(name).Interface())
+	}
+	return relationKey(values)
+}
+
 func (m *Model) loadRelationData(params interface{}) error {
 	if len(m.withList) == 0 {
 		return nil
@@ -48,21 +74,24 @@ func (m *Model) loadRelationDataItem(index int, item map[string]interface{}) err
 				continue
 			}
 
-			pk := field.GetPrimaryKey()
-			fk := field.GetForeignKey()
+			pks := field.GetPrimaryKeys()
+			values := make([]interface{}, 0, len(pks))
+			for _, pk := range pks {
+				values = append(values, item[pk])
+			}
 			if m.relationData[field.Name] == nil {
 				m.relationData[field.Name] = make([]*relation, 0)
 			}
 			r := &relation{
 				Type: mod.Type,
-				PrimaryKey: pk,
-				ForeignKey: fk,
+				PrimaryKeys: pks,
+				ForeignKeys: field.GetForeignNames(),
 				Field: field,
-				Value: item[pk],
+				Values: values,
 				WithCond: cond,
 			}
 			m.relationData[field.Name] = append(m.relationData[field.Name], r)
-			m.relationMap[fmt.Sprintf("%v", item[pk])] = r
+			m.relationMap[relationKey(values)] = r
 		}
 	}
 
@@ -74,13 +103,13 @@ func (m *Model) fetchRelationDbData() error {
 	// 读取数据库
 	if len(m.relationData) > 0 {
 		for _, v := range m.relationData {
-			pks := make([]interface{}, 0)
+			pks := make([][]interface{}, 0)
 			var (
 				relation *relation
 			)
 			for _, data := range v {
 				relation = data
-				pks = append(pks, data.Value)
+				pks = append(pks, data.Values)
 			}
 			if relation == nil {
 				continue
@@ -91,19 +120,27 @@ func (m *Model) fetchRelationDbData() error {
 
 			ptr.Elem().Set(reflect.MakeSlice(sliceOf, 0, 0))
 
-			dbHand := m.context.Model(ptr.Interface())
+			dbHand := m.relationModel(ptr.Interface())
 			if relation.WithCond != nil {
 				relation.WithCond(dbHand)
 			}
-			if err := dbHand.Where(relation.ForeignKey, "in", pks).Select().Error; err != nil {
+			if len(relation.ForeignKeys) == 1 {
+				values := make([]interface{}, 0, len(pks))
+				for _, pk := range pks {
+					values = append(values, pk[0])
+				}
+				dbHand.Where(relation.ForeignKeys[0], "in", values)
+			} else {
+				dbHand.builder.AddWhereTuplesIn("and", relation.ForeignKeys, pks)
+			}
+			if err := dbHand.Select().Error; err != nil {
 				return err
 			}
 
 			mapData := make(map[string][]*reflect.Value)
 			for i := 0; i < ptr.Elem().Len(); i++ {
 				f := ptr.Elem().Index(i)
-				id := f.FieldByName(relation.Field.GetForeignName())
-				k := fmt.Sprintf("%v", id.Interface())
+				k := relationValueKey(f, relation.ForeignKeys)
 				if mapData[k] == nil {
 					mapData[k] = make([]*reflect.Value, 0)
 				}
@@ -114,8 +151,7 @@ func (m *Model) fetchRelationDbData() error {
 			if typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array {
 				for i := 0; i < m.schema.Data.Len(); i++ {
 					row := m.schema.Data.Index(i)
-					id := row.FieldByName(relation.Field.GetPrimaryName())
-					idKey := fmt.Sprintf("%v", id.Interface())
+					idKey := relationValueKey(row, relation.Field.GetPrimaryNames())
 					if mapData[idKey] != nil {
 						for _, v2 := range mapData[idKey] {
 							fieldValue := row.FieldByName(relation.Field.Name)
@@ -127,8 +163,7 @@ func (m *Model) fetchRelationDbData() error {
 				}
 			} else {
 				row := m.schema.Data
-				id := row.FieldByName(relation.Field.GetPrimaryName())
-				idKey := fmt.Sprintf("%v", id.Interface())
+				idKey := relationValueKey(row, relation.Field.GetPrimaryNames())
 				if mapData[idKey] != nil {
 					for _, v2 := range mapData[idKey] {
 						fieldValue := row.FieldByName(relation.Field.Name)
@@ -181,14 +216,16 @@ func (m *Model) insertRelationData() error {
 		if v.FieldType.Kind() == reflect.Slice || v.FieldType.Kind() == reflect.Array {
 			for i := 0; i < f.Len(); i++ {
 				row := f.Index(i)
-				name := relation.Field.GetPrimaryName()
-				pv := m.schema.Data.FieldByName(name)
-				row.FieldByName(relation.Field.GetForeignName()).Set(pv)
+				fks := relation.Field.GetForeignNames()
+				for j, name := range relation.Field.GetPrimaryNames() {
+					pv := m.schema.Data.FieldByName(name)
+					row.FieldByName(fks[j]).Set(pv)
+				}
 				rowData := row.Addr().Interface()
 				//if row.Kind() == reflect.Ptr {
 				//	row = row.Elem()
 				//}
-				if err := m.context.Model(rowData).Create(); err != nil {
+				if err := m.relationModel(rowData).Create(); err != nil {
 					return err
 				}
 			}
@@ -199,7 +236,7 @@ func (m *Model) insertRelationData() error {
 		if f.Kind() == reflect.Ptr {
 			f = f.Elem()
 		}
-		if err := m.context.Model(f.Interface()).Create(); err != nil {
+		if err := m.relationModel(f.Interface()).Create(); err != nil {
 			return err
 		}
 	}
@@ -226,7 +263,7 @@ func (m *Model) updateRelationData() error {
 				if row.Kind() == reflect.Ptr {
 					row = row.Elem()
 				}
-				if err := m.context.Model(row.Interface()).Update(); err != nil {
+				if err := m.relationModel(row.Interface()).Update(); err != nil {
 					return err
 				}
 			}
@@ -237,7 +274,7 @@ func (m *Model) updateRelationData() error {
 		if f.Kind() == reflect.Ptr {
 			f = f.Elem()
 		}
-		if err := m.context.Model(f.Interface()).Update(); err != nil {
+		if err := m.relationModel(f.Interface()).Update(); err != nil {
 			return err
 		}
 	}
@@ -264,7 +301,7 @@ func (m *Model) deleteRelationData() error {
 				if row.Kind() == reflect.Ptr {
 					row = row.Elem()
 				}
-				if err := m.context.Model(row.Interface()).Delete(); err != nil {
+				if err := m.relationModel(row.Interface()).Delete(); err != nil {
 					return err
 				}
 			}
@@ -275,7 +312,7 @@ func (m *Model) deleteRelationData() error {
 		if f.Kind() == reflect.Ptr {
 			f = f.Elem()
 		}
-		if err := m.context.Model(f.Interface()).Delete(); err != nil {
+		if err := m.relationModel(f.Interface()).Delete(); err != nil {
 			return err
 		}
 	}
@@ -1,8 +1,13 @@
 package schema
 
 import (
+	"database/sql/driver"
+	"github.com/wdaglb/korm/sqltype"
 	"github.com/wdaglb/korm/utils"
 	"reflect"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
@@ -26,6 +31,14 @@ type Field struct {
 	FieldType reflect.Type
 	IndirectFieldType reflect.Type
 	DeepType reflect.Type
+	PrimaryKey bool
+	AutoIncrement bool
+	NotNull bool
+	Unique bool
+	Size int
+	Index string
+	HasDefaultValue bool
+	DefaultValue string
 }
 
 func (field *Field) GetColumnName() string {
@@ -64,3 +77,150 @@ func (field *Field) GetForeignKey() string {
 	}
 	return field.Schema.FieldNameToColumnName(val)
 }
+
+// 关联的主键字段名, 复合主键时pk标签以,分隔
+func (field *Field) GetPrimaryNames() []string {
+	val := field.Tag.Get("pk")
+	if val == "" {
+		return field.Schema.PrimaryKeys
+	}
+	return strings.Split(val, ",")
+}
+
+// 关联的外键字段名, 与主键字段一一对应
+func (field *Field) GetForeignNames() []string {
+	val := field.Tag.Get("fk")
+	if val == "" {
+		names := make([]string, 0, len(field.Schema.PrimaryKeys))
+		for _, pk := range field.Schema.PrimaryKeys {
+			names = append(names, field.Name+pk)
+		}
+		return names
+	}
+	return strings.Split(val, ",")
+}
+
+// 关联的主键列名
+func (field *Field) GetPrimaryKeys() []string {
+	names := field.GetPrimaryNames()
+	cols := make([]string, 0, len(names))
+	for _, name := range names {
+		cols = append(cols, field.Schema.FieldNameToColumnName(name))
+	}
+	return cols
+}
+
+// 获取korm标签项
+func (field *Field) Setting(name string) (string, bool) {
+	val, ok := field.TagSetting[strings.ToLower(name)]
+	return val, ok
+}
+
+// 是否声明了korm标签项
+func (field *Field) hasKormFlag(name string) bool {
+	_, ok := field.Setting(name)
+	return ok
+}
+
+// 解析korm标签中的列属性
+func (field *Field) parseTagSetting() {
+	field.TagSetting = utils.ParseTagSetting(field.Tag.Get("korm"))
+	field.PrimaryKey = field.hasKormFlag("primaryKey")
+	field.AutoIncrement = field.hasKormFlag("autoIncrement")
+	field.NotNull = field.hasKormFlag("notNull")
+	field.Unique = field.hasKormFlag("unique")
+	if val, ok := field.Setting("size"); ok {
+		field.Size, _ = strconv.Atoi(val)
+	}
+	if val, ok := field.Setting("index"); ok {
+		field.Index = val
+		if val == "" {
+			field.Index = "idx_" + field.ColumnName
+		}
+	}
+	field.DefaultValue, field.HasDefaultValue = field.Setting("default")
+}
+
+// 是否软删除字段
+func (field *Field) IsSoftDelete() bool {
+	if field.IndirectFieldType == reflect.TypeOf(sqltype.DeletedAt{}) {
+		return true
+	}
+	return field.hasKormFlag("softDelete")
+}
+
+// 是否创建时间字段, 标签autoCreateTime或命名为CreateTime/CreatedAt
+func (field *Field) IsAutoCreateTime() bool {
+	if field.hasKormFlag("autoCreateTime") {
+		return true
+	}
+	return field.isTimeType() && (field.Name == "CreateTime" || field.Name == "CreatedAt")
+}
+
+// 是否更新时间字段, 标签autoUpdateTime或命名为UpdateTime/UpdatedAt
+func (field *Field) IsAutoUpdateTime() bool {
+	if field.hasKormFlag("autoUpdateTime") {
+		return true
+	}
+	return field.isTimeType() && (field.Name == "UpdateTime" || field.Name == "UpdatedAt")
+}
+
+// 是否乐观锁版本字段
+func (field *Field) IsVersion() bool {
+	return field.hasKormFlag("version") && (field.DataType == Int || field.DataType == Uint)
+}
+
+// 版本字段的下一个版本值
+func (field *Field) NextVersion(current interface{}) reflect.Value {
+	value := reflect.New(field.FieldType).Elem()
+	cur := reflect.ValueOf(current)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value.SetInt(cur.Int() + 1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value.SetUint(cur.Uint() + 1)
+	}
+	return value
+}
+
+// 是否可保存时间的字段类型
+func (field *Field) isTimeType() bool {
+	return field.DataType == Time || field.DataType == Int || field.DataType == Uint
+}
+
+// 字段零值对应的数据库值, nil表示NULL
+func (field *Field) ZeroValue() interface{} {
+	val, err := driver.DefaultParameterConverter.ConvertValue(reflect.Zero(field.FieldType).Interface())
+	if err != nil {
+		return nil
+	}
+	return val
+}
+
+// 按字段类型转换时间值
+func (field *Field) TimeValue(t time.Time) reflect.Value {
+	value := reflect.New(field.FieldType).Elem()
+	dst := value
+	if dst.Kind() == reflect.Ptr {
+		dst.Set(reflect.New(field.IndirectFieldType))
+		dst = dst.Elem()
+	}
+	switch dst.Interface().(type) {
+	case sqltype.DeletedAt:
+		dst.Set(reflect.ValueOf(sqltype.DeletedAt{Time: t, Valid: true}))
+		return value
+	}
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		dst.SetInt(t.Unix())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		dst.SetUint(uint64(t.Unix()))
+	case reflect.String:
+		dst.SetString(t.Format(dateFormat))
+	default:
+		if reflect.TypeOf(t).ConvertibleTo(dst.Type()) {
+			dst.Set(reflect.ValueOf(t).Convert(dst.Type()))
+		}
+	}
+	return value
+}
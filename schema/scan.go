@@ -0,0 +1,218 @@
+package schema
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/wdaglb/korm/mixins"
+	"github.com/wdaglb/korm/utils"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+const dateFormat = "2006-01-02 15:04:05"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// 将驱动返回的值写入目标字段
+func ScanValue(src interface{}, dst reflect.Value) error {
+	if sv := reflect.ValueOf(src); sv.Kind() == reflect.Ptr {
+		if sv.IsNil() {
+			src = nil
+		} else {
+			src = sv.Elem().Interface()
+		}
+	}
+	// NULL写入零值, 获取器类型同样置为零值, 不交给其Scan处理
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	if dst.CanAddr() {
+		if scanner, ok := dst.Addr().Interface().(mixins.Scanner); ok {
+			return scanner.Scan(src)
+		}
+	}
+	if dst.Kind() == reflect.Ptr {
+		value := reflect.New(dst.Type().Elem())
+		if err := ScanValue(src, value.Elem()); err != nil {
+			return err
+		}
+		dst.Set(value)
+		return nil
+	}
+
+	switch v := src.(type) {
+	case time.Time:
+		if timeType.ConvertibleTo(dst.Type()) {
+			dst.Set(reflect.ValueOf(v).Convert(dst.Type()))
+			return nil
+		}
+		if dst.Kind() == reflect.String {
+			dst.SetString(v.Format(dateFormat))
+			return nil
+		}
+	case []byte:
+		if dst.Kind() == reflect.Slice && dst.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, len(v))
+			copy(b, v)
+			dst.SetBytes(b)
+			return nil
+		}
+	}
+
+	switch dst.Kind() {
+	case reflect.String:
+		dst.SetString(utils.AsString(src))
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch v := src.(type) {
+		case int64:
+			dst.SetInt(v)
+			return nil
+		case float64:
+			dst.SetInt(int64(v))
+			return nil
+		case bool:
+			if v {
+				dst.SetInt(1)
+			} else {
+				dst.SetInt(0)
+			}
+			return nil
+		}
+		val, err := strconv.ParseInt(utils.AsString(src), 10, dst.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("converting %q to %s: %v", utils.AsString(src), dst.Kind(), err)
+		}
+		dst.SetInt(val)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v, ok := src.(int64); ok {
+			dst.SetUint(uint64(v))
+			return nil
+		}
+		val, err := strconv.ParseUint(utils.AsString(src), 10, dst.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("converting %q to %s: %v", utils.AsString(src), dst.Kind(), err)
+		}
+		dst.SetUint(val)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		if v, ok := src.(float64); ok {
+			dst.SetFloat(v)
+			return nil
+		}
+		val, err := strconv.ParseFloat(utils.AsString(src), dst.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("converting %q to %s: %v", utils.AsString(src), dst.Kind(), err)
+		}
+		dst.SetFloat(val)
+		return nil
+	case reflect.Bool:
+		if v, ok := src.(int64); ok {
+			dst.SetBool(v != 0)
+			return nil
+		}
+		val, err := strconv.ParseBool(utils.AsString(src))
+		if err != nil {
+			return fmt.Errorf("converting %q to %s: %v", utils.AsString(src), dst.Kind(), err)
+		}
+		dst.SetBool(val)
+		return nil
+	case reflect.Slice:
+		if dst.Type().Elem().Kind() == reflect.Uint8 {
+			dst.SetBytes([]byte(utils.AsString(src)))
+			return nil
+		}
+	case reflect.Struct:
+		if timeType.ConvertibleTo(dst.Type()) {
+			str := utils.AsString(src)
+			if str == "" || str == "0000-00-00 00:00:00" {
+				dst.Set(reflect.Zero(dst.Type()))
+				return nil
+			}
+			t, err := time.ParseInLocation(dateFormat, str, time.Local)
+			if err != nil {
+				if t, err = time.Parse(time.RFC3339Nano, str); err != nil {
+					return fmt.Errorf("converting %q to time: %v", str, err)
+				}
+			}
+			dst.Set(reflect.ValueOf(t).Convert(dst.Type()))
+			return nil
+		}
+	}
+
+	sv := reflect.ValueOf(src)
+	if sv.Type().ConvertibleTo(dst.Type()) {
+		dst.Set(sv.Convert(dst.Type()))
+		return nil
+	}
+	return fmt.Errorf("unsupported scan, storing %T into %s", src, dst.Type())
+}
+
+// 列扫描目标
+type columnScanner struct {
+	field reflect.Value
+	raw   interface{}
+}
+
+func (c *columnScanner) Scan(src interface{}) error {
+	if c.field.IsValid() {
+		return ScanValue(src, c.field)
+	}
+	if b, ok := src.([]byte); ok {
+		c.raw = string(b)
+	} else {
+		c.raw = src
+	}
+	return nil
+}
+
+// 行扫描器, 按列名把查询结果直接写入结构字段
+type RowScanner struct {
+	columns  []string
+	fields   []*Field
+	scanners []columnScanner
+	dests    []interface{}
+}
+
+// 创建行扫描器, 同一次查询的所有行可复用
+func (schema *Schema) NewRowScanner(columns []string) *RowScanner {
+	s := &RowScanner{
+		columns:  columns,
+		fields:   make([]*Field, len(columns)),
+		scanners: make([]columnScanner, len(columns)),
+		dests:    make([]interface{}, len(columns)),
+	}
+	for i, col := range columns {
+		s.fields[i] = schema.ColumnNames[col]
+		s.dests[i] = &s.scanners[i]
+	}
+	return s
+}
+
+// 扫描当前行到dst结构, dst无效时所有列作为原始值返回
+func (s *RowScanner) Scan(rows *sql.Rows, dst reflect.Value) (map[string]interface{}, error) {
+	for i, field := range s.fields {
+		s.scanners[i].raw = nil
+		if field != nil && dst.IsValid() {
+			s.scanners[i].field = dst.FieldByIndex(field.StructField.Index)
+		} else {
+			s.scanners[i].field = reflect.Value{}
+		}
+	}
+	if err := rows.Scan(s.dests...); err != nil {
+		return nil, err
+	}
+
+	row := make(map[string]interface{}, len(s.columns))
+	for i, col := range s.columns {
+		if s.scanners[i].field.IsValid() {
+			row[col] = s.scanners[i].field.Interface()
+		} else {
+			row[col] = s.scanners[i].raw
+		}
+	}
+	return row, nil
+}
@@ -0,0 +1,84 @@
+package schema
+
+import (
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/wdaglb/korm/sqltype"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type scanTest struct {
+	Id       int64
+	Price    float64
+	Name     string
+	Enabled  bool
+	Data     []byte
+	Created  time.Time
+	Updated  sqltype.Timestamp
+	Optional *int64
+}
+
+// 测试驱动值直接写入字段
+func TestScanValue(t *testing.T) {
+	var row scanTest
+	value := reflect.ValueOf(&row).Elem()
+	raw := []byte("binary")
+	now := time.Date(2021, 5, 1, 10, 0, 0, 0, time.Local)
+
+	assert.NoError(t, ScanValue(int64(12), value.FieldByName("Id")))
+	assert.NoError(t, ScanValue([]byte("12.5"), value.FieldByName("Price")))
+	assert.NoError(t, ScanValue([]byte("name"), value.FieldByName("Name")))
+	assert.NoError(t, ScanValue(int64(1), value.FieldByName("Enabled")))
+	assert.NoError(t, ScanValue(raw, value.FieldByName("Data")))
+	assert.NoError(t, ScanValue([]byte("2021-05-01 10:00:00"), value.FieldByName("Created")))
+	assert.NoError(t, ScanValue(int64(now.Unix()), value.FieldByName("Updated")))
+	assert.NoError(t, ScanValue(int64(7), value.FieldByName("Optional")))
+	raw[0] = 'B'
+
+	assert.Equal(t, int64(12), row.Id)
+	assert.Equal(t, 12.5, row.Price)
+	assert.Equal(t, "name", row.Name)
+	assert.True(t, row.Enabled)
+	assert.Equal(t, []byte("binary"), row.Data)
+	assert.True(t, now.Equal(row.Created))
+	assert.True(t, now.Equal(time.Time(row.Updated)))
+	assert.Equal(t, int64(7), *row.Optional)
+
+	assert.Error(t, ScanValue([]byte("abc"), value.FieldByName("Id")))
+}
+
+type nullTest struct {
+	Id      int64
+	Name    *string
+	Created *time.Time
+	Remark  sql.NullString
+	Amount  sql.NullInt64
+	Count   int
+}
+
+// 测试NULL值写入指针及sql.Null类型字段
+func TestScanNull(t *testing.T) {
+	name := "name"
+	row := nullTest{Name: &name, Count: 3}
+	value := reflect.ValueOf(&row).Elem()
+	schema := NewSchema(&row)
+
+	for _, f := range []string{"Name", "Created", "Remark", "Amount", "Count"} {
+		assert.NoError(t, schema.SetStructValue(nil, value.FieldByName(f)))
+	}
+	assert.Nil(t, row.Name)
+	assert.Nil(t, row.Created)
+	assert.False(t, row.Remark.Valid)
+	assert.False(t, row.Amount.Valid)
+	assert.Equal(t, 0, row.Count)
+	assert.NotEmpty(t, schema.FieldNames["Remark"].DataType)
+
+	assert.NoError(t, ScanValue([]byte("remark"), value.FieldByName("Remark")))
+	assert.NoError(t, ScanValue(int64(5), value.FieldByName("Amount")))
+	assert.NoError(t, ScanValue([]byte("2021-05-01 10:00:00"), value.FieldByName("Created")))
+	assert.Equal(t, sql.NullString{String: "remark", Valid: true}, row.Remark)
+	assert.Equal(t, sql.NullInt64{Int64: 5, Valid: true}, row.Amount)
+	assert.Equal(t, 2021, row.Created.Year())
+}
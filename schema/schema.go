@@ -1,55 +1,171 @@
 package schema
 
 import (
+	"database/sql/driver"
 	"fmt"
 	"github.com/wdaglb/korm/mixins"
+	"github.com/wdaglb/korm/sqltype"
 	"github.com/wdaglb/korm/utils"
 	"go/ast"
 	"reflect"
-	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 type Schema struct {
 	Type reflect.Type
-	PrimaryKey string
+	PrimaryKey string // 第一个主键字段
+	PrimaryKeys []string // 全部主键字段, 复合主键时有多个
 	TableName string
+	Conn string // 模型声明的连接名
 	Data reflect.Value
 	Fields []*Field
 	FieldNames map[string]*Field
+	ColumnNames map[string]*Field
 	Relations map[string]*Relation
 	WithList []string
+	SoftDelete *Field // 软删除字段
+	AutoCreateTime *Field // 创建时间字段
+	AutoUpdateTime *Field // 更新时间字段
+	Version *Field // 乐观锁版本字段
 }
 
+// 已解析的模型结构, 以类型为键
+var schemaCache sync.Map
+
+// 创建模型结构, 类型信息从缓存读取, 仅Data与当前调用相关
 func NewSchema(data interface{}) *Schema {
-	schema := &Schema{}
-	schema.Type = reflect.TypeOf(data)
-	for schema.Type.Kind() == reflect.Slice || schema.Type.Kind() == reflect.Array || schema.Type.Kind() == reflect.Ptr {
-		schema.Type = schema.Type.Elem()
+	typ := reflect.TypeOf(data)
+	for typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array || typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
 	}
-	schema.TableName = utils.Camel2Case(schema.Type.Name())
+	schema := *Parse(typ)
 	schema.Data = utils.Indirect(reflect.ValueOf(data))
+	return &schema
+}
+
+// 解析模型类型, 结果会被缓存, 返回值不可修改
+func Parse(typ reflect.Type) *Schema {
+	if cached, ok := schemaCache.Load(typ); ok {
+		return cached.(*Schema)
+	}
+	cached, _ := schemaCache.LoadOrStore(typ, parseSchema(typ))
+	return cached.(*Schema)
+}
+
+// 解析模型类型的字段、关联、主键及表名
+func parseSchema(typ reflect.Type) *Schema {
+	schema := &Schema{}
+	schema.Type = typ
+	schema.TableName = utils.Camel2Case(schema.Type.Name())
 
 	yumData := reflect.New(schema.Type)
 	if ext, ok := yumData.Interface().(mixins.ModelTable); ok {
 		schema.TableName = ext.Table()
 	}
-	schema.PrimaryKey = "Id"
-	if ext, ok := schema.Data.Interface().(mixins.ModelPk); ok {
-		schema.PrimaryKey = ext.Pk()
+	if ext, ok := yumData.Interface().(mixins.ModelConn); ok {
+		schema.Conn = ext.Conn()
 	}
 	schema.Relations = make(map[string]*Relation)
 	schema.FieldNames = make(map[string]*Field)
-	for i := 0; i < schema.Type.NumField(); i++ {
-		if fieldStruct := schema.Type.Field(i); ast.IsExported(fieldStruct.Name) {
-			field := schema.AddField(fieldStruct)
-			schema.Fields = append(schema.Fields, field)
-			schema.FieldNames[field.Name] = field
-		}
+	schema.ColumnNames = make(map[string]*Field)
+	schema.parseFields(schema.Type, nil, "")
+	if ext, ok := yumData.Interface().(mixins.ModelPk); ok {
+		schema.PrimaryKeys = strings.Split(ext.Pk(), ",")
 	}
+	if len(schema.PrimaryKeys) == 0 {
+		schema.PrimaryKeys = []string{"Id"}
+	}
+	schema.PrimaryKey = schema.PrimaryKeys[0]
 	return schema
 }
 
+// 解析结构字段, 嵌入结构的字段会展开到当前模型
+func (schema *Schema) parseFields(typ reflect.Type, index []int, prefix string) {
+	for i := 0; i < typ.NumField(); i++ {
+		fieldStruct := typ.Field(i)
+		settings := utils.ParseTagSetting(fieldStruct.Tag.Get("korm"))
+		if _, ok := settings["-"]; ok {
+			continue
+		}
+		fieldStruct.Index = append(append([]int{}, index...), i)
+		if isEmbeddedField(fieldStruct, settings) {
+			schema.parseFields(fieldStruct.Type, fieldStruct.Index, prefix+settings["prefix"])
+			continue
+		}
+		if !ast.IsExported(fieldStruct.Name) {
+			continue
+		}
+		// 同名字段以层级浅的为准
+		if exist := schema.FieldNames[fieldStruct.Name]; exist != nil {
+			if len(exist.StructField.Index) <= len(fieldStruct.Index) {
+				continue
+			}
+			schema.removeField(exist)
+		}
+
+		field := schema.AddField(fieldStruct)
+		field.ColumnName = prefix + field.ColumnName
+		if field.PrimaryKey {
+			schema.PrimaryKeys = append(schema.PrimaryKeys, field.Name)
+		}
+		schema.Fields = append(schema.Fields, field)
+		schema.FieldNames[field.Name] = field
+		if field.DataType != "" {
+			schema.ColumnNames[field.ColumnName] = field
+		}
+		if field.IsSoftDelete() {
+			schema.SoftDelete = field
+		} else if field.IsAutoCreateTime() {
+			schema.AutoCreateTime = field
+		} else if field.IsAutoUpdateTime() {
+			schema.AutoUpdateTime = field
+		} else if field.IsVersion() {
+			schema.Version = field
+		}
+	}
+}
+
+// 移除已解析的字段
+func (schema *Schema) removeField(field *Field) {
+	for i, f := range schema.Fields {
+		if f == field {
+			schema.Fields = append(schema.Fields[:i], schema.Fields[i+1:]...)
+			break
+		}
+	}
+	if schema.ColumnNames[field.ColumnName] == field {
+		delete(schema.ColumnNames, field.ColumnName)
+	}
+	delete(schema.FieldNames, field.Name)
+}
+
+// 是否需要展开的嵌入结构: 匿名结构或使用embedded标签声明
+func isEmbeddedField(fieldStruct reflect.StructField, settings map[string]string) bool {
+	if fieldStruct.Type.Kind() != reflect.Struct {
+		return false
+	}
+	if _, ok := settings["embedded"]; !ok && !fieldStruct.Anonymous {
+		return false
+	}
+	if fieldStruct.Type.ConvertibleTo(reflect.TypeOf(time.Time{})) {
+		return false
+	}
+	_, isScanner := reflect.New(fieldStruct.Type).Interface().(mixins.Scanner)
+	return !isScanner
+}
+
+// 是否主键字段
+func (schema *Schema) IsPrimaryKey(name string) bool {
+	return utils.InStrArray(schema.PrimaryKeys, name)
+}
+
+// 是否复合主键
+func (schema *Schema) IsCompositeKey() bool {
+	return len(schema.PrimaryKeys) > 1
+}
+
 func (schema *Schema) IsArray() bool {
 	typ := schema.Data.Type()
 	return typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array
@@ -77,6 +193,7 @@ func (schema *Schema) AddField(structField reflect.StructField) *Field {
 
 	tagDb := field.GetColumnName()
 	field.ColumnName = tagDb
+	field.parseTagSetting()
 	fieldValue := reflect.New(field.IndirectFieldType)
 
 	switch reflect.Indirect(fieldValue).Kind() {
@@ -93,6 +210,8 @@ func (schema *Schema) AddField(structField reflect.StructField) *Field {
 	case reflect.Struct:
 		if _, ok := fieldValue.Interface().(*time.Time); ok {
 			field.DataType = Time
+		} else if _, ok := fieldValue.Interface().(*sqltype.DeletedAt); ok {
+			field.DataType = Time
 		} else if fieldValue.Type().ConvertibleTo(reflect.TypeOf(time.Time{})) {
 			field.DataType = Time
 		} else if fieldValue.Type().ConvertibleTo(reflect.TypeOf(&time.Time{})) {
@@ -101,7 +220,10 @@ func (schema *Schema) AddField(structField reflect.StructField) *Field {
 			dvt := fieldValue.Interface()
 
 			if _, ok := dvt.(mixins.Scanner); ok {
-				fmt.Printf("获取器")
+				// 同时实现Valuer的类型(sql.Null*、decimal、JSON包装等)作为列, 只实现Scanner的不作为列
+				if _, ok := dvt.(driver.Valuer); ok {
+					field.DataType = String
+				}
 			} else {
 				schema.loadRelation("one", field, fieldValue)
 			}
@@ -143,10 +265,8 @@ func (schema *Schema) GetFieldName(name string) *Field {
 
 // 字段修改为数据库字段名
 func (schema *Schema) FieldNameToColumnName(col string) string {
-	for f, v := range schema.FieldNames {
-		if col == f {
-			return v.GetColumnName()
-		}
+	if field := schema.FieldNames[col]; field != nil {
+		return field.ColumnName
 	}
 	return col
 }
@@ -157,122 +277,59 @@ func (schema *Schema) GetFieldValue(name string) interface{} {
 	if field == nil {
 		return nil
 	}
-	fieldData := schema.Data.FieldByName(name)
+	fieldData := schema.Data.FieldByIndex(field.StructField.Index)
 	return fieldData.Interface()
 }
 
+// 设置时间字段为当前时间, 返回写入数据库的值
+func (schema *Schema) SetFieldTime(field *Field, t time.Time) interface{} {
+	value := field.TimeValue(t)
+	if fieldData := schema.Data.FieldByIndex(field.StructField.Index); fieldData.CanSet() {
+		fieldData.Set(value)
+	}
+	return value.Interface()
+}
+
 // 设置字段值
 func (schema *Schema) SetFieldValue(name string, value interface{}) error {
 	field := schema.FieldNames[name]
 	if field == nil {
 		return nil
 	}
-	fieldData := schema.Data.FieldByName(name)
+	fieldData := schema.Data.FieldByIndex(field.StructField.Index)
 	return schema.SetStructValue(value, fieldData)
 }
 
-// 设置结构值
+// 设置结构值, 支持关联模型赋值及NULL值
 func (schema *Schema) SetStructValue(src interface{}, dst reflect.Value) (err error) {
-	if src == nil {
-		return nil
-	}
-	sv := utils.Indirect(reflect.ValueOf(src))
-	if dst.Kind() == sv.Kind() && sv.Type().ConvertibleTo(dst.Type()) {
-		dst.Set(sv.Convert(dst.Type()))
-		return nil
-	}
-
-	switch dst.Kind() {
-	case reflect.Ptr:
-		if dst.IsValid() {
-			dst.Set(reflect.New(dst.Type().Elem()))
-
-			dvt := dst.Interface()
-
-			if scanner, ok := dvt.(mixins.Scanner); ok {
-				fmt.Printf("name: %v, %v, %v\n", sv, dst.IsValid(), dst.Type())
-				return scanner.Scan(src)
-			}
-			dst.Elem().Set(sv)
+	if src != nil {
+		sv := utils.Indirect(reflect.ValueOf(src))
+		if sv.IsValid() && dst.Kind() == sv.Kind() && sv.Type().ConvertibleTo(dst.Type()) {
+			dst.Set(sv.Convert(dst.Type()))
 			return nil
 		}
-		return schema.SetStructValue(src, dst)
-	case reflect.Slice, reflect.Array:
-		if sv.Kind() == reflect.String {
-			val := []byte(fmt.Sprintf("%v", sv.Interface()))
-			rv := reflect.MakeSlice(dst.Type(), 0, 20)
-			for _, v := range val {
-				rv = reflect.Append(rv, reflect.ValueOf(v))
-			}
-			dst.Set(rv)
-			fmt.Printf("type: %v\n", sv.Type())
-			return
-		}
-		rv := reflect.New(dst.Type().Elem())
-		if rv.Kind() == reflect.Ptr {
-			rv = rv.Elem()
-		}
-		rv.Set(sv)
-		newSlice := reflect.Append(dst, rv)
-		dst.Set(newSlice)
-	case reflect.Struct:
-		if dst.IsValid() {
-			var (
-				dvt interface{}
-				newVal reflect.Value
-				isPtr = dst.Type().Kind() == reflect.Ptr
-			)
-			if isPtr {
-				dst.Set(reflect.New(dst.Type()))
-				dvt = dst.Interface()
-			} else {
-				newVal = reflect.New(dst.Type())
-				dvt = newVal.Interface()
-			}
-
-			if scanner, ok := dvt.(mixins.Scanner); ok {
-				err = scanner.Scan(src)
-			}
-			if !isPtr {
-				dst.Set(newVal.Elem())
-			}
-		}
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		if src == nil {
-			return fmt.Errorf("converting NULL to %s is unsupported", dst.Kind())
-		}
-		s := utils.AsString(src)
-		val, _ := strconv.ParseInt(s, 10, dst.Type().Bits())
-		dst.SetInt(val)
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		if src == nil {
-			return fmt.Errorf("converting NULL to %s is unsupported", dst.Kind())
-		}
-		s := utils.AsString(src)
-		val, _ := strconv.ParseUint(s, 10, dst.Type().Bits())
-		dst.SetUint(val)
-	case reflect.Float32, reflect.Float64:
-		if src == nil {
-			return fmt.Errorf("converting NULL to %s is unsupported", dst.Kind())
+		// 一对多关联追加元素
+		if sv.IsValid() && sv.Kind() == reflect.Struct && dst.Kind() == reflect.Slice && sv.Type().ConvertibleTo(dst.Type().Elem()) {
+			dst.Set(reflect.Append(dst, sv.Convert(dst.Type().Elem())))
+			return nil
 		}
-		s := utils.AsString(src)
-		val, _ := strconv.ParseFloat(s, dst.Type().Bits())
-		dst.SetFloat(val)
-	case reflect.String:
-		dst.SetString(src.(string))
-	default:
-		fmt.Printf("type: %v\n", dst.Kind())
 	}
-	return
+	return ScanValue(src, dst)
 }
 
 // 获取结构值
 func (schema *Schema) GetStructValue(name string) reflect.Value {
+	if field := schema.FieldNames[name]; field != nil {
+		return schema.Data.FieldByIndex(field.StructField.Index)
+	}
 	return schema.Data.FieldByName(name)
 }
 
 // 获取数组元素的结构值
 func (schema *Schema) GetArrayStructValue(index int, name string) reflect.Value {
+	if field := schema.FieldNames[name]; field != nil {
+		return schema.Data.Index(index).FieldByIndex(field.StructField.Index)
+	}
 	return schema.Data.Index(index).FieldByName(name)
 }
 
@@ -288,7 +345,7 @@ func (schema *Schema) AddArrayItem(data map[string]interface{}) {
 
 	for i := 0; i < len(schema.Fields); i++ {
 		field := schema.Fields[i]
-		fieldValue := newValue.Field(i)
+		fieldValue := newValue.FieldByIndex(field.StructField.Index)
 
 		if field.DataType != "" {
 			if err := schema.SetStructValue(data[field.ColumnName], fieldValue); err != nil {
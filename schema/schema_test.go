@@ -0,0 +1,161 @@
+package schema
+
+import (
+	"database/sql/driver"
+	"github.com/stretchr/testify/assert"
+	"github.com/wdaglb/korm/sqltype"
+	"reflect"
+	"testing"
+)
+
+type tagTest struct {
+	Uid      int64  `korm:"column:uid;primaryKey;autoIncrement"`
+	UserName string `korm:"column:user_name;size:64;notNull;index:idx_user;unique"`
+	Status   int    `db:"status" korm:"default:1;index"`
+	Nick     string `json:"nickname,omitempty"`
+	Temp     string `korm:"-"`
+	Secret   string `json:"-"`
+}
+
+// 测试korm标签解析
+func TestTagSetting(t *testing.T) {
+	schema := NewSchema(&tagTest{})
+	assert.Equal(t, "Uid", schema.PrimaryKey)
+	assert.Nil(t, schema.FieldNames["Temp"])
+
+	uid := schema.FieldNames["Uid"]
+	assert.Equal(t, "uid", uid.ColumnName)
+	assert.True(t, uid.PrimaryKey)
+	assert.True(t, uid.AutoIncrement)
+
+	name := schema.FieldNames["UserName"]
+	assert.Equal(t, "user_name", name.ColumnName)
+	assert.Equal(t, 64, name.Size)
+	assert.True(t, name.NotNull)
+	assert.True(t, name.Unique)
+	assert.Equal(t, "idx_user", name.Index)
+	val, ok := name.Setting("NOTNULL")
+	assert.True(t, ok)
+	assert.Equal(t, "", val)
+
+	status := schema.FieldNames["Status"]
+	assert.Equal(t, "status", status.ColumnName)
+	assert.True(t, status.HasDefaultValue)
+	assert.Equal(t, "1", status.DefaultValue)
+	assert.Equal(t, "idx_status", status.Index)
+
+	assert.Equal(t, "Nick", schema.FieldNames["Nick"].ColumnName)
+	assert.Equal(t, "Secret", schema.FieldNames["Secret"].ColumnName)
+}
+
+type benchTest struct {
+	Id         int64  `db:"id"`
+	User       string `db:"user"`
+	Status     int    `db:"status"`
+	Remark     *string
+	CreateTime int64 `db:"create_time"`
+	UpdateTime int64 `db:"update_time"`
+}
+
+// 测试结构缓存与调用数据分离
+func TestSchemaCache(t *testing.T) {
+	a, b := &benchTest{Id: 1}, &benchTest{Id: 2}
+	sa, sb := NewSchema(a), NewSchema(b)
+	assert.Same(t, sa.FieldNames["Id"], sb.FieldNames["Id"])
+	assert.Equal(t, int64(1), sa.GetFieldValue("Id"))
+	assert.Equal(t, int64(2), sb.GetFieldValue("Id"))
+}
+
+// 使用缓存创建模型结构
+func BenchmarkNewSchema(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		NewSchema(&benchTest{})
+	}
+}
+
+// 不使用缓存解析模型结构
+func BenchmarkParseSchema(b *testing.B) {
+	typ := reflect.TypeOf(benchTest{})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		parseSchema(typ)
+	}
+}
+
+type BaseModel struct {
+	Id         int64 `db:"id"`
+	CreateTime int64 `db:"create_time"`
+	UpdateTime int64 `db:"update_time"`
+}
+
+type address struct {
+	City   string `db:"city"`
+	Street string `db:"street"`
+}
+
+type embeddedTest struct {
+	BaseModel
+	Name    string  `db:"name"`
+	Address address `korm:"embedded;prefix:addr_"`
+}
+
+// 测试嵌入结构展开
+func TestEmbedded(t *testing.T) {
+	row := &embeddedTest{}
+	schema := NewSchema(row)
+	assert.Empty(t, schema.Relations)
+	assert.Empty(t, schema.WithList)
+	assert.Equal(t, "Id", schema.PrimaryKey)
+	assert.Equal(t, "CreateTime", schema.AutoCreateTime.Name)
+	assert.Equal(t, "addr_city", schema.FieldNames["City"].ColumnName)
+	assert.Equal(t, []int{2, 0}, schema.ColumnNames["addr_city"].StructField.Index)
+
+	columns := make([]string, 0)
+	for _, f := range schema.Fields {
+		columns = append(columns, f.ColumnName)
+	}
+	assert.Equal(t, []string{"id", "create_time", "update_time", "name", "addr_city", "addr_street"}, columns)
+
+	assert.NoError(t, schema.SetFieldValue("Id", int64(5)))
+	assert.NoError(t, schema.SetFieldValue("City", "shenzhen"))
+	assert.Equal(t, int64(5), row.Id)
+	assert.Equal(t, "shenzhen", row.Address.City)
+}
+
+type customScanner struct {
+	Raw string
+}
+
+func (c *customScanner) Scan(src interface{}) error {
+	return nil
+}
+
+type customValuer struct {
+	Raw string
+}
+
+func (c *customValuer) Scan(src interface{}) error {
+	return nil
+}
+
+func (c customValuer) Value() (driver.Value, error) {
+	return c.Raw, nil
+}
+
+type scannerTest struct {
+	Id      int64
+	Custom  customScanner
+	Value   customValuer
+	Deleted sqltype.DeletedAt
+}
+
+// 测试获取器字段是否作为列
+func TestScannerField(t *testing.T) {
+	schema := NewSchema(&scannerTest{})
+	assert.Equal(t, "", schema.FieldNames["Custom"].DataType)
+	assert.Nil(t, schema.Relations["Custom"])
+	assert.Equal(t, String, schema.FieldNames["Value"].DataType)
+	assert.Nil(t, schema.Relations["Value"])
+	assert.Equal(t, Time, schema.FieldNames["Deleted"].DataType)
+}
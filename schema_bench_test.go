@@ -0,0 +1,64 @@
+package korm
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/wdaglb/korm/sqltype"
+	"testing"
+	"time"
+)
+
+type TestBench struct {
+	Id         int64             `db:"id"`
+	User       string            `db:"user"`
+	Score      float64           `db:"score"`
+	Remark     *string           `db:"remark"`
+	CreateTime sqltype.Timestamp `db:"create_time"`
+	UpdateTime sqltype.DateTime  `db:"update_time"`
+}
+
+func setBenchTable(n int) {
+	rows := make([][]driver.Value, n)
+	for i := range rows {
+		rows[i] = []driver.Value{int64(i + 1), []byte(fmt.Sprintf("user%d", i)), 1.5, nil, int64(1620000000), []byte("2021-05-01 10:00:00")}
+	}
+	setFakeTable("bench", []string{"id", "user", "score", "remark", "create_time", "update_time"}, rows)
+}
+
+// 测试使用假驱动查询多行数据
+func TestFakeSelect(t *testing.T) {
+	setBenchTable(3)
+	var rows []TestBench
+	coll := newFakeModel("bench", &rows).Select()
+	assert.NoError(t, coll.Error)
+	assert.Len(t, rows, 3)
+	assert.Equal(t, int64(3), rows[2].Id)
+	assert.Equal(t, "user2", rows[2].User)
+	assert.Nil(t, rows[0].Remark)
+	assert.Equal(t, int64(1620000000), time.Time(rows[0].CreateTime).Unix())
+}
+
+// 查询1000行数据
+func BenchmarkSelect1k(b *testing.B) {
+	setBenchTable(1000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var rows []TestBench
+		if err := newFakeModel("bench", &rows).Select().Error; err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// 按主键查询单行, 主要开销为模型结构的解析
+func BenchmarkFind(b *testing.B) {
+	setBenchTable(1)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		row := &TestBench{}
+		if err := newFakeModel("bench", row).Where("Id", 1).Find().Error; err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package korm
+
+import (
+	"fmt"
+	"github.com/wdaglb/korm/utils"
+	"reflect"
+	"sync"
+)
+
+// 查询范围, 返回附加条件后的模型
+type ScopeFunc func(db *Model) *Model
+
+// 命名查询范围, args为调用Scope时传入的参数
+type NamedScopeFunc func(db *Model, args ...interface{}) *Model
+
+// 默认查询范围, 添加的条件在查询、统计、更新、删除时自动附加, 可使用Unscoped忽略
+type ModelDefaultScope interface {
+	DefaultScope(db *Model)
+}
+
+type scopeKey struct {
+	typ  reflect.Type
+	name string
+}
+
+// 按模型类型注册的命名查询范围
+var namedScopes sync.Map
+
+// 为模型类型注册命名查询范围, model可为结构、结构指针或切片
+func RegisterScope(model interface{}, name string, fn NamedScopeFunc) {
+	namedScopes.Store(scopeKey{typ: scopeType(model), name: name}, fn)
+}
+
+// 模型对应的结构类型
+func scopeType(model interface{}) reflect.Type {
+	typ := utils.IndirectType(reflect.TypeOf(model))
+	for typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array {
+		typ = utils.IndirectType(typ.Elem())
+	}
+	return typ
+}
+
+// 依次应用查询范围
+func (m *Model) Scopes(funcs ...ScopeFunc) *Model {
+	for _, fn := range funcs {
+		m = fn(m)
+	}
+	return m
+}
+
+// 应用已注册的命名查询范围, 未注册时记录错误, 由之后的执行方法返回
+func (m *Model) Scope(name string, args ...interface{}) *Model {
+	if m.err != nil {
+		return m
+	}
+	fn, ok := namedScopes.Load(scopeKey{typ: m.schema.Type, name: name})
+	if !ok {
+		m.err = fmt.Errorf("scope %s not registered for %s", name, m.schema.Type.Name())
+		return m
+	}
+	return fn.(NamedScopeFunc)(m, args...)
+}
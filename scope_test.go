@@ -0,0 +1,58 @@
+package korm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func scopeScore(db *Model) *Model {
+	return db.Where("Score", ">", 1)
+}
+
+// 测试组合查询范围
+func TestScopes(t *testing.T) {
+	RegisterScope(&[]TestBench{}, "User", func(db *Model, args ...interface{}) *Model {
+		return db.Where("User", args[0])
+	})
+	var rows []TestBench
+	m := newTestModel(&rows).Scopes(scopeScore).Scope("User", "a")
+	sqlStr, params := buildSql(m, "select")
+	assert.Equal(t, "SELECT `id`,`user`,`score`,`remark`,`create_time`,`update_time` FROM `test_bench` WHERE `score`>? and `user`=?", sqlStr)
+	assert.Equal(t, []interface{}{1, "a"}, params)
+
+	// 未注册的命名范围不panic, 由执行方法返回错误且不执行语句
+	table := setFakeTable("scope", []string{"id"}, nil)
+	var soft []TestSoft
+	coll := newFakeModel("scope", &soft).Scope("User", "a").Where("Id", 1).Select()
+	assert.EqualError(t, coll.Error, "scope User not registered for TestSoft")
+	assert.Empty(t, table.queries)
+	_, err := newFakeModel("scope", &TestSoft{}).Scope("User", "a").Count()
+	assert.Error(t, err)
+}
+
+type TestScoped struct {
+	Id     int64 `db:"id"`
+	Status int   `db:"status"`
+}
+
+// 默认范围内使用With等链式方法不会panic
+func (TestScoped) DefaultScope(db *Model) {
+	db.Where("Status", 1).WhereOr("Status", 2).With("Missing")
+}
+
+// 测试模型默认查询范围
+func TestDefaultScope(t *testing.T) {
+	sqlStr, params := buildSql(newTestModel(&TestScoped{}).Where("Id", 3), "select")
+	assert.Equal(t, "SELECT `id`,`status` FROM `test_scoped` WHERE (`id`=?) AND (`status`=? or `status`=?)", sqlStr)
+	assert.Equal(t, []interface{}{3, 1, 2}, params)
+
+	m := newTestModel(&TestScoped{Id: 3})
+	m.wherePrimaryKey()
+	sqlStr, params = buildSql(m, "delete")
+	assert.Equal(t, "DELETE FROM `test_scoped` WHERE (`id`=?) AND (`status`=? or `status`=?)", sqlStr)
+	assert.Equal(t, []interface{}{int64(3), 1, 2}, params)
+
+	sqlStr, params = buildSql(newTestModel(&TestScoped{}).Unscoped(), "select")
+	assert.Equal(t, "SELECT `id`,`status` FROM `test_scoped`", sqlStr)
+	assert.Empty(t, params)
+}
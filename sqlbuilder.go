@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/wdaglb/korm/schema"
 	"github.com/wdaglb/korm/utils"
+	"reflect"
 	"strings"
 )
 
@@ -20,13 +21,22 @@ type SqlBuilder struct {
 	clearField   bool
 	orders       []string
 	where        *Where
+	scope        *Where // 附加条件, 与where以AND连接
 	group        []string
 	having       *Where
 	offset       *int
 	limit        *int
+	upsert       *upsertClause // 插入冲突时的处理
 	bindParams   []interface{}
 }
 
+// 插入冲突时的处理
+type upsertClause struct {
+	conflict []string // 判断冲突的字段名, mysql以表上的唯一索引判断, 仅在无需更新时使用
+	updates  []string // 冲突时更新的字段名, 为空时保留原数据
+	guard    string   // 冲突行的该字段与插入值相同时才更新, 用于多租户隔离
+}
+
 type SqlField struct {
 	Name  string
 	IsRaw bool
@@ -45,7 +55,41 @@ func NewSqlBuilder(model *Model, schema *schema.Schema) *SqlBuilder {
 	return sq
 }
 
+// 复制构造器的查询状态, 副本归属于model
+func (t *SqlBuilder) clone(model *Model) *SqlBuilder {
+	c := *t
+	c.model = model
+	c.fields = append([]SqlField(nil), t.fields...)
+	c.ignoreFields = append([]string(nil), t.ignoreFields...)
+	c.rawFields = append([]string(nil), t.rawFields...)
+	c.orders = append([]string(nil), t.orders...)
+	c.group = append([]string(nil), t.group...)
+	c.where = t.where.clone(&c)
+	c.scope = t.scope.clone(&c)
+	c.having = t.having.clone(&c)
+	if t.data != nil {
+		c.data = make(map[string]interface{}, len(t.data))
+		for k, v := range t.data {
+			c.data[k] = v
+		}
+	}
+	if t.offset != nil {
+		offset := *t.offset
+		c.offset = &offset
+	}
+	if t.limit != nil {
+		limit := *t.limit
+		c.limit = &limit
+	}
+	c.resultFields = nil
+	c.bindParams = nil
+	return &c
+}
+
 func (t *SqlBuilder) parseField(field string, raw bool) string {
+	if f := t.schema.FieldNames[field]; f != nil && !raw {
+		return utils.QuoteColumn(t.model.db.dbConf.Driver, f.ColumnName, raw)
+	}
 	return utils.ParseField(t.model.db.dbConf.Driver, t.schema.Type, field, raw)
 }
 
@@ -72,6 +116,16 @@ func (t *SqlBuilder) AddFieldRaw(str string) *SqlBuilder {
 	return t
 }
 
+// 是否已指定字段
+func (t *SqlBuilder) hasField(name string) bool {
+	for _, f := range t.fields {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 // 忽略字段
 func (t *SqlBuilder) IgnoreField(str string) *SqlBuilder {
 	fields := strings.Split(str, ",")
@@ -104,6 +158,134 @@ func (t *SqlBuilder) AddWhere(logic string, field string, op interface{}, condit
 	return t
 }
 
+// 添加附加条件, 不受where中or条件影响
+func (t *SqlBuilder) AddScope(field string, op interface{}, condition ...interface{}) *SqlBuilder {
+	var value interface{}
+	if len(condition) == 0 {
+		value = op
+		op = "="
+	} else {
+		value = condition[0]
+	}
+	if t.scope == nil {
+		t.scope = &Where{
+			builder: t,
+		}
+	}
+	t.scope.AddCondition(WhereCondition{
+		Logic:     "and",
+		Field:     t.parseField(field, false),
+		Operator:  op.(string),
+		Condition: value,
+	})
+
+	return t
+}
+
+// 添加原生条件
+func (t *SqlBuilder) AddWhereRaw(logic string, sql string, args ...interface{}) *SqlBuilder {
+	if t.where == nil {
+		t.where = &Where{
+			builder: t,
+		}
+	}
+	t.where.AddCondition(WhereCondition{
+		Logic:     logic,
+		Field:     sql,
+		Condition: args,
+		raw:       true,
+	})
+	return t
+}
+
+// 添加多字段in条件, 生成 (a=? and b=?) or (a=? and b=?)
+func (t *SqlBuilder) AddWhereTuplesIn(logic string, fields []string, values [][]interface{}) *SqlBuilder {
+	sql, args := t.tuplesIn(fields, values)
+	return t.AddWhereRaw(logic, sql, args...)
+}
+
+// 生成多字段in条件的sql及参数
+func (t *SqlBuilder) tuplesIn(fields []string, values [][]interface{}) (string, []interface{}) {
+	groups := make([]string, 0, len(values))
+	args := make([]interface{}, 0, len(fields)*len(values))
+	for _, tuple := range values {
+		conds := make([]string, 0, len(fields))
+		for i, f := range fields {
+			conds = append(conds, t.parseField(f, false)+"=?")
+			args = append(args, tuple[i])
+		}
+		groups = append(groups, "("+strings.Join(conds, " and ")+")")
+	}
+	if len(groups) == 0 {
+		return "1=0", args
+	}
+	return strings.Join(groups, " or "), args
+}
+
+// 添加原生附加条件
+func (t *SqlBuilder) AddScopeRaw(sql string, args ...interface{}) *SqlBuilder {
+	if t.scope == nil {
+		t.scope = &Where{
+			builder: t,
+		}
+	}
+	t.scope.AddCondition(WhereCondition{
+		Logic:     "and",
+		Field:     sql,
+		Condition: args,
+		raw:       true,
+	})
+	return t
+}
+
+// 添加游标分页条件, 取排序在values之后的数据
+// mysql排序方向一致时生成 (a,b) > (?,?), 其它情况展开为 a>? or (a=? and b>?)
+func (t *SqlBuilder) AddScopeSeek(fields []string, desc []bool, values []interface{}) *SqlBuilder {
+	cols := make([]string, len(fields))
+	sameDirection := true
+	for i, f := range fields {
+		cols[i] = t.parseField(f, false)
+		sameDirection = sameDirection && desc[i] == desc[0]
+	}
+	op := func(i int) string {
+		if desc[i] {
+			return "<"
+		}
+		return ">"
+	}
+	if sameDirection && len(fields) > 1 && t.model.db.dbConf.Driver == "mysql" {
+		marks := strings.TrimSuffix(strings.Repeat("?,", len(fields)), ",")
+		sql := fmt.Sprintf("(%s) %s (%s)", strings.Join(cols, ","), op(0), marks)
+		return t.AddScopeRaw(sql, values...)
+	}
+	groups := make([]string, 0, len(fields))
+	args := make([]interface{}, 0)
+	for i := range fields {
+		conds := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			conds = append(conds, cols[j]+"=?")
+			args = append(args, values[j])
+		}
+		conds = append(conds, cols[i]+op(i)+"?")
+		args = append(args, values[i])
+		groups = append(groups, "("+strings.Join(conds, " and ")+")")
+	}
+	return t.AddScopeRaw(strings.Join(groups, " or "), args...)
+}
+
+// 以主键值列表作为附加条件, 复合主键的每个值为按声明顺序排列的切片
+func (t *SqlBuilder) AddScopePkIn(values []interface{}) *SqlBuilder {
+	if !t.schema.IsCompositeKey() {
+		return t.AddScope(t.schema.PrimaryKey, "in", values)
+	}
+	tuples := make([][]interface{}, 0, len(values))
+	for _, v := range values {
+		tuples = append(tuples, utils.ToInterfaceSlice(v))
+	}
+	sql, args := t.tuplesIn(t.schema.PrimaryKeys, tuples)
+	return t.AddScopeRaw(sql, args...)
+}
+
 func (t *SqlBuilder) AddOrder(field string, val string) *SqlBuilder {
 	t.orders = append(t.orders, t.parseField(field, false)+" "+val)
 	return t
@@ -153,7 +335,114 @@ func (t *SqlBuilder) GetTable() string {
 	return table
 }
 
+// 生成where条件, 附加条件与用户条件以AND连接
+func (t *SqlBuilder) whereString() string {
+	list := make([]string, 0)
+	if t.where != nil {
+		list = append(list, t.where.ToString())
+	}
+	if t.scope != nil {
+		list = append(list, t.scope.ToString())
+	}
+	if str := t.defaultScopeString(); str != "" {
+		list = append(list, str)
+	}
+	if t.p == "select" {
+		if str := t.softDeleteString(); str != "" {
+			list = append(list, str)
+		}
+	}
+	if len(list) < 2 {
+		return strings.Join(list, "")
+	}
+	return "(" + strings.Join(list, ") AND (") + ")"
+}
+
+// 模型默认查询范围的条件
+func (t *SqlBuilder) defaultScopeString() string {
+	if t.model.unscoped {
+		return ""
+	}
+	ext, ok := reflect.New(t.schema.Type).Interface().(ModelDefaultScope)
+	if !ok {
+		return ""
+	}
+	tmp := newModel(t.model.context, t.model.model, t.schema, t.model.db)
+	ext.DefaultScope(tmp)
+	if tmp.builder.where == nil {
+		return ""
+	}
+	// 参数绑定到当前构造器
+	tmp.builder.where.builder = t
+	return tmp.builder.where.ToString()
+}
+
+// 软删除条件
+func (t *SqlBuilder) softDeleteString() string {
+	field := t.schema.SoftDelete
+	if field == nil || t.model.trashed == trashedWith {
+		return ""
+	}
+	col := t.parseField(field.Name, false)
+	zero := field.ZeroValue()
+	if t.model.trashed == trashedOnly {
+		if zero == nil {
+			return col + " IS NOT NULL"
+		}
+		t.bindParam(zero)
+		return col + "<>?"
+	}
+	if zero == nil {
+		return col + " IS NULL"
+	}
+	t.bindParam(zero)
+	return col + "=?"
+}
+
+// upsert时已赋值的自增主键需要写入, 用于判断冲突
+func (t *SqlBuilder) writeAutoKey(name string) bool {
+	if t.upsert == nil {
+		return false
+	}
+	v := reflect.ValueOf(t.data[name])
+	return v.IsValid() && !v.IsZero()
+}
+
+// 插入冲突时的处理语句, 目前仅支持mysql
+// 单主键时附加 pk=LAST_INSERT_ID(pk), 使冲突时同样返回已有记录的id
+func (t *SqlBuilder) upsertString() string {
+	sets := make([]string, 0, len(t.upsert.updates)+1)
+	// 设置了guard时冲突行不属于同一租户则保持原值
+	value := func(col string, expr string) string {
+		if t.upsert.guard == "" {
+			return expr
+		}
+		guard := t.parseField(t.upsert.guard, false)
+		return fmt.Sprintf("IF(%s=VALUES(%s),%s,%s)", guard, guard, expr, col)
+	}
+	autoKey := ""
+	if !t.schema.IsCompositeKey() && t.schema.FieldNames[t.schema.PrimaryKey] != nil {
+		autoKey = t.schema.PrimaryKey
+		col := t.parseField(autoKey, false)
+		sets = append(sets, col+"="+value(col, fmt.Sprintf("LAST_INSERT_ID(%s)", col)))
+	}
+	for _, name := range t.upsert.updates {
+		if name == autoKey || name == t.upsert.guard || t.schema.FieldNames[name] == nil {
+			continue
+		}
+		col := t.parseField(name, false)
+		sets = append(sets, col+"="+value(col, fmt.Sprintf("VALUES(%s)", col)))
+	}
+	if len(sets) == 0 {
+		col := t.parseField(t.upsert.conflict[0], false)
+		sets = append(sets, fmt.Sprintf("%s=%s", col, col))
+	}
+	return " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ",")
+}
+
+// 生成sql及绑定参数, 每次调用重新收集参数, 可重复执行
 func (t *SqlBuilder) ToString() (string, []interface{}) {
+	t.bindParams = nil
 	str := ""
 	switch t.p {
 	case "select":
@@ -187,8 +476,7 @@ func (t *SqlBuilder) ToString() (string, []interface{}) {
 				continue
 			}
 			fsv = append(fsv, t.parseField(v.Name, v.IsRaw))
-			vf, _ := utils.ParseFieldDb(t.schema.Type, v.Name)
-			t.resultFields[v.Name] = vf
+			t.resultFields[v.Name] = t.schema.FieldNameToColumnName(v.Name)
 		}
 		for _, v := range t.rawFields {
 			fsv = append(fsv, v)
@@ -222,22 +510,32 @@ func (t *SqlBuilder) ToString() (string, []interface{}) {
 		}
 
 		for _, k := range fs {
-			if k.Name == t.schema.PrimaryKey {
+			// 单主键由数据库自增, 复合主键需要写入
+			if k.Name == t.schema.PrimaryKey && !t.schema.IsCompositeKey() && !t.writeAutoKey(k.Name) {
 				continue
 			}
 			f := t.schema.FieldNames[k.Name]
-			if f.DataType == "" {
+			if f.DataType == "" || (f.AutoIncrement && !t.writeAutoKey(k.Name)) {
 				continue
 			}
 			if utils.InStrArray(t.ignoreFields, k.Name) {
 				continue
 			}
+			// 有默认值的字段为nil时交由数据库填充, 零值照常写入
+			if f.HasDefaultValue {
+				if v := reflect.ValueOf(t.data[k.Name]); !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+					continue
+				}
+			}
 			t.bindParam(t.data[k.Name])
 			keys = append(keys, t.parseField(k.Name, k.IsRaw))
 			values = append(values, "?")
 		}
 		str = strings.ReplaceAll(str, "[columns]", strings.Join(keys, ","))
 		str = strings.ReplaceAll(str, "[values]", strings.Join(values, ","))
+		if t.upsert != nil {
+			str += t.upsertString()
+		}
 	case "update":
 		str = "UPDATE [table] SET [values]"
 		values := make([]string, 0)
@@ -260,7 +558,7 @@ func (t *SqlBuilder) ToString() (string, []interface{}) {
 		}
 
 		for _, k := range fs {
-			if k.Name == t.schema.PrimaryKey {
+			if t.schema.IsPrimaryKey(k.Name) {
 				continue
 			}
 			f := t.schema.FieldNames[k.Name]
@@ -281,8 +579,8 @@ func (t *SqlBuilder) ToString() (string, []interface{}) {
 
 	switch t.p {
 	case "select", "update", "delete":
-		if t.where != nil {
-			str += " WHERE " + t.where.ToString()
+		if where := t.whereString(); where != "" {
+			str += " WHERE " + where
 		}
 	}
 	if len(t.group) > 0 {
@@ -298,8 +596,10 @@ func (t *SqlBuilder) ToString() (string, []interface{}) {
 	switch t.model.db.dbConf.Driver {
 	case "mssql":
 		if t.offset != nil {
-			str += fmt.Sprintf(" OFFSET %d", *t.offset)
-			str += fmt.Sprintf(" ROWS FETCH NEXT %d ROWS ONLY", *t.limit)
+			str += fmt.Sprintf(" OFFSET %d ROWS", *t.offset)
+			if t.limit != nil {
+				str += fmt.Sprintf(" FETCH NEXT %d ROWS ONLY", *t.limit)
+			}
 		}
 	case "mysql":
 		if t.p == "select" {
@@ -0,0 +1,226 @@
+package korm
+
+import (
+	"database/sql/driver"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/wdaglb/korm/sqltype"
+	"testing"
+	"time"
+)
+
+type TestSoft struct {
+	Id        int64             `db:"id"`
+	Name      string            `db:"name"`
+	DeletedAt sqltype.DeletedAt `db:"deleted_at"`
+}
+
+type TestSoftTag struct {
+	Id         int64             `db:"id"`
+	DeleteTime sqltype.Timestamp `db:"delete_time" korm:"softDelete"`
+}
+
+// 构造不连接数据库的模型, 用于检查生成的sql
+func newTestModel(mod interface{}) *Model {
+	mainConnect.dbList["builder"] = &kdb{config: &Config{}, dbConf: &DbConfig{Driver: "mysql"}}
+	return UseContext("builder").Model(mod)
+}
+
+func buildSql(m *Model, p string) (string, []interface{}) {
+	m.builder.p = p
+	return m.builder.ToString()
+}
+
+// 测试软删除查询条件
+func TestSoftDeleteSelect(t *testing.T) {
+	var rows []TestSoft
+	sqlStr, params := buildSql(newTestModel(&rows), "select")
+	assert.Equal(t, "SELECT `id`,`name`,`deleted_at` FROM `test_soft` WHERE `deleted_at` IS NULL", sqlStr)
+	assert.Empty(t, params)
+
+	sqlStr, params = buildSql(newTestModel(&rows).WhereOr("Id", 1).WhereOr("Id", 2), "select")
+	assert.Equal(t, "SELECT `id`,`name`,`deleted_at` FROM `test_soft` WHERE (`id`=? or `id`=?) AND (`deleted_at` IS NULL)", sqlStr)
+	assert.Equal(t, []interface{}{1, 2}, params)
+
+	sqlStr, _ = buildSql(newTestModel(&rows).OnlyTrashed(), "select")
+	assert.Equal(t, "SELECT `id`,`name`,`deleted_at` FROM `test_soft` WHERE `deleted_at` IS NOT NULL", sqlStr)
+
+	sqlStr, _ = buildSql(newTestModel(&rows).WithTrashed(), "select")
+	assert.Equal(t, "SELECT `id`,`name`,`deleted_at` FROM `test_soft`", sqlStr)
+}
+
+// 测试标签声明的软删除字段
+func TestSoftDeleteTag(t *testing.T) {
+	var rows []TestSoftTag
+	sqlStr, params := buildSql(newTestModel(&rows), "select")
+	assert.Equal(t, "SELECT `id`,`delete_time` FROM `test_soft_tag` WHERE `delete_time`=?", sqlStr)
+	assert.Equal(t, []interface{}{int64(0)}, params)
+}
+
+type TestTime struct {
+	Id         int64             `db:"id"`
+	User       string            `db:"user"`
+	CreateTime sqltype.Timestamp `db:"create_time"`
+	UpdateTime sqltype.DateTime  `db:"update_time"`
+}
+
+// 测试自动维护创建/更新时间
+func TestAutoTime(t *testing.T) {
+	table := setFakeTable("autotime", nil, nil)
+	row := &TestTime{User: "test"}
+	m := newFakeModel("autotime", row)
+	assert.Equal(t, "CreateTime", m.schema.AutoCreateTime.Name)
+	assert.Equal(t, "UpdateTime", m.schema.AutoUpdateTime.Name)
+
+	assert.NoError(t, m.Create())
+	assert.Equal(t, "INSERT INTO `test_time` (`user`,`create_time`,`update_time`) VALUES (?,?,?)", table.queries[0])
+	assert.False(t, time.Time(row.CreateTime).IsZero())
+	assert.False(t, time.Time(row.UpdateTime).IsZero())
+
+	row.UpdateTime = sqltype.DateTime{}
+	assert.NoError(t, UseContext("autotime").Model(row).UpdateColumns(map[string]interface{}{"User": "new"}))
+	assert.Equal(t, "UPDATE `test_time` SET `user`=?,`update_time`=? WHERE `id`=?", table.queries[1])
+	assert.Equal(t, "new", table.args[1][0])
+	assert.NotNil(t, table.args[1][1])
+	assert.False(t, time.Time(row.UpdateTime).IsZero())
+	assert.Equal(t, int64(1), table.args[1][2])
+
+	row.UpdateTime = sqltype.DateTime{}
+	assert.NoError(t, UseContext("autotime").Model(row).Field("User").Update())
+	assert.Equal(t, "UPDATE `test_time` SET `user`=?,`update_time`=? WHERE `id`=?", table.queries[2])
+	assert.False(t, time.Time(row.UpdateTime).IsZero())
+}
+
+type TestVersion struct {
+	Id      int64 `db:"id"`
+	Stock   int   `db:"stock"`
+	Version int64 `db:"version" korm:"version"`
+}
+
+// 测试乐观锁条件
+func TestVersionScope(t *testing.T) {
+	table := setFakeTable("version", nil, nil)
+	table.results = []int64{0}
+	row := &TestVersion{Id: 1, Stock: 5, Version: 3}
+	m := newFakeModel("version", row)
+	assert.Equal(t, "Version", m.schema.Version.Name)
+
+	err := m.Update()
+	assert.True(t, errors.Is(err, ErrStaleObject))
+	assert.Equal(t, int64(3), row.Version)
+	assert.Equal(t, "UPDATE `test_version` SET `stock`=?,`version`=? WHERE (`id`=?) AND (`version`=?)", table.queries[0])
+	assert.Equal(t, []driver.Value{int64(5), int64(4), int64(1), int64(3)}, table.args[0])
+
+	assert.NoError(t, UseContext("version").Model(row).Update())
+	assert.Equal(t, int64(4), row.Version)
+	assert.Equal(t, []driver.Value{int64(5), int64(4), int64(1), int64(3)}, table.args[1])
+
+	// 同一模型多次更新, 每次只使用当前版本作为条件
+	m = UseContext("version").Model(row)
+	assert.NoError(t, m.Update())
+	assert.NoError(t, m.Update())
+	assert.Equal(t, int64(6), row.Version)
+	assert.Equal(t, table.queries[0], table.queries[3])
+	assert.Equal(t, []driver.Value{int64(5), int64(5), int64(1), int64(4)}, table.args[2])
+	assert.Equal(t, []driver.Value{int64(5), int64(6), int64(1), int64(5)}, table.args[3])
+	assert.Nil(t, m.builder.where)
+	assert.Nil(t, m.builder.scope)
+}
+
+type TestBase struct {
+	Id         int64 `db:"id"`
+	CreateTime int64 `db:"create_time"`
+}
+
+type TestEmbedded struct {
+	TestBase
+	City string `db:"city"`
+}
+
+type TestEmbeddedPrefix struct {
+	Id   int64        `db:"id"`
+	Addr TestEmbedded `korm:"embedded;prefix:addr_"`
+}
+
+// 测试嵌入结构的字段生成
+func TestEmbeddedSelect(t *testing.T) {
+	sqlStr, params := buildSql(newTestModel(&TestEmbedded{}).Where("Id", 1), "select")
+	assert.Equal(t, "SELECT `id`,`create_time`,`city` FROM `test_embedded` WHERE `id`=?", sqlStr)
+	assert.Equal(t, []interface{}{1}, params)
+
+	sqlStr, _ = buildSql(newTestModel(&TestEmbeddedPrefix{}).Where("City", "sz"), "select")
+	assert.Equal(t, "SELECT `id`,`addr_create_time`,`addr_city` FROM `test_embedded_prefix` WHERE `addr_city`=?", sqlStr)
+}
+
+type TestUserRole struct {
+	UserId int64  `db:"user_id" korm:"primaryKey"`
+	RoleId int64  `db:"role_id" korm:"primaryKey"`
+	Remark string `db:"remark"`
+}
+
+// 测试复合主键的条件生成
+func TestCompositeKey(t *testing.T) {
+	row := &TestUserRole{UserId: 1, RoleId: 2, Remark: "admin"}
+	m := newTestModel(&row)
+	assert.Equal(t, []string{"UserId", "RoleId"}, m.schema.PrimaryKeys)
+	assert.True(t, m.schema.IsCompositeKey())
+
+	m.builder.data = map[string]interface{}{"UserId": row.UserId, "RoleId": row.RoleId, "Remark": row.Remark}
+	sqlStr, params := buildSql(m, "insert")
+	assert.Equal(t, "INSERT INTO `test_user_role` (`user_id`,`role_id`,`remark`) VALUES (?,?,?)", sqlStr)
+	assert.Equal(t, []interface{}{int64(1), int64(2), "admin"}, params)
+
+	m = newTestModel(&row)
+	m.builder.data = map[string]interface{}{"UserId": row.UserId, "RoleId": row.RoleId, "Remark": row.Remark}
+	m.wherePrimaryKey()
+	sqlStr, params = buildSql(m, "update")
+	assert.Equal(t, "UPDATE `test_user_role` SET `remark`=? WHERE `user_id`=? and `role_id`=?", sqlStr)
+	assert.Equal(t, []interface{}{"admin", int64(1), int64(2)}, params)
+
+	m = newTestModel(&row)
+	m.builder.AddWhereTuplesIn("and", []string{"UserId", "RoleId"}, [][]interface{}{{1, 2}, {3, 4}})
+	sqlStr, params = buildSql(m, "delete")
+	assert.Equal(t, "DELETE FROM `test_user_role` WHERE ((`user_id`=? and `role_id`=?) or (`user_id`=? and `role_id`=?))", sqlStr)
+	assert.Equal(t, []interface{}{1, 2, 3, 4}, params)
+}
+
+// 测试时间字段为NULL时读取为零值
+func TestNullTimeColumn(t *testing.T) {
+	setFakeTable("null_time", []string{"id", "user", "create_time", "update_time"}, [][]driver.Value{{int64(1), []byte("a"), nil, nil}})
+	var rows []TestTime
+	assert.NoError(t, newFakeModel("null_time", &rows).Select().Error)
+	if assert.Len(t, rows, 1) {
+		assert.Equal(t, "a", rows[0].User)
+		assert.True(t, time.Time(rows[0].CreateTime).IsZero())
+		assert.True(t, time.Time(rows[0].UpdateTime).IsZero())
+	}
+
+	row := &TestTime{}
+	assert.NoError(t, UseContext("null_time").Model(row).Find().Error)
+	assert.True(t, time.Time(row.CreateTime).IsZero())
+}
+
+type TestDefault struct {
+	Id     int64 `db:"id"`
+	Status int   `db:"status" korm:"default:1"`
+	Level  *int  `db:"level" korm:"default:2"`
+}
+
+// 测试有默认值字段的写入
+func TestDefaultValueInsert(t *testing.T) {
+	m := newTestModel(&TestDefault{})
+	m.builder.data = map[string]interface{}{"Id": int64(0), "Status": 0, "Level": (*int)(nil)}
+	sqlStr, params := buildSql(m, "insert")
+	assert.Equal(t, "INSERT INTO `test_default` (`status`) VALUES (?)", sqlStr)
+	assert.Equal(t, []interface{}{0}, params)
+}
+
+// 测试原生条件与普通条件互不影响
+func TestWhereRawFlag(t *testing.T) {
+	var rows []TestSoft
+	m := newTestModel(&rows).WithTrashed().WhereRaw("`id` > ?", 1)
+	m.builder.AddWhere("and", "Name", "raw", "a")
+	sqlStr, params := buildSql(m, "select")
+	assert.Equal(t, "SELECT `id`,`name`,`deleted_at` FROM `test_soft` WHERE (`id` > ?) and `name`raw?", sqlStr)
+	assert.Equal(t, []interface{}{1, "a"}, params)
+}
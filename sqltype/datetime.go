@@ -50,6 +50,8 @@ func (t DateTime) MarshalJSON() ([]byte, error) {
 func (t *DateTime) Scan(value interface{}) error {
 	//s := value.(time.Time)
 	switch ty := value.(type) {
+	case nil:
+		*t = DateTime{}
 	case time.Time:
 		*t = DateTime(ty)
 	case int64:
@@ -0,0 +1,78 @@
+package sqltype
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// 软删除时间, 未删除时为NULL
+type DeletedAt struct {
+	Time  time.Time
+	Valid bool
+}
+
+func (t DeletedAt) MarshalJSON() ([]byte, error) {
+	if !t.Valid {
+		return []byte("null"), nil
+	}
+	return []byte(fmt.Sprintf("\"%v\"", t.Time.Format(dateFormat))), nil
+}
+
+func (t *DeletedAt) UnmarshalJSON(data []byte) error {
+	str := string(data)
+	if str == "null" {
+		t.Valid = false
+		return nil
+	}
+	t1, err := time.Parse(`"`+dateFormat+`"`, str)
+	if err != nil {
+		return err
+	}
+	t.Time, t.Valid = t1, true
+	return nil
+}
+
+func (t *DeletedAt) Scan(value interface{}) error {
+	var str string
+	switch ty := value.(type) {
+	case nil:
+		t.Time, t.Valid = time.Time{}, false
+		return nil
+	case time.Time:
+		t.Time, t.Valid = ty, true
+		return nil
+	case int64:
+		t.Time, t.Valid = time.Unix(ty, 0), true
+		return nil
+	case []byte:
+		str = string(ty)
+	case string:
+		str = ty
+	default:
+		return errors.New("time format failed")
+	}
+	if str == "" {
+		t.Time, t.Valid = time.Time{}, false
+		return nil
+	}
+	if val, err := strconv.ParseInt(str, 10, 64); err == nil {
+		t.Time, t.Valid = time.Unix(val, 0), true
+		return nil
+	}
+	t1, err := time.ParseInLocation(dateFormat, str, time.Local)
+	if err != nil {
+		return err
+	}
+	t.Time, t.Valid = t1, true
+	return nil
+}
+
+func (t DeletedAt) Value() (driver.Value, error) {
+	if !t.Valid {
+		return nil, nil
+	}
+	return t.Time.Format(dateFormat), nil
+}
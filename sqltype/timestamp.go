@@ -49,6 +49,8 @@ func (t Timestamp) MarshalJSON() ([]byte, error) {
 func (t *Timestamp) Scan(value interface{}) error {
 	//s := value.(time.Time)
 	switch ty := value.(type) {
+	case nil:
+		*t = Timestamp{}
 	case time.Time:
 		*t = Timestamp(ty)
 	case int64:
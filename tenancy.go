@@ -0,0 +1,82 @@
+package korm
+
+// 多租户插件使用的回调名称
+const (
+	tenancyQuery  = "korm:tenancy_query"
+	tenancyInsert = "korm:tenancy_insert"
+	tenancyUpdate = "korm:tenancy_update"
+	tenancyDelete = "korm:tenancy_delete"
+)
+
+// 设置当前租户id, 注册多租户插件后按租户隔离数据
+func (ctx *Context) SetTenant(id interface{}) *Context {
+	ctx.tenant = id
+	return ctx
+}
+
+// 当前租户id
+func (ctx *Context) Tenant() interface{} {
+	return ctx.tenant
+}
+
+// 返回忽略租户隔离的Context, 用于管理后台等需要跨租户操作的场景
+func (ctx *Context) IgnoreTenant() *Context {
+	newCtx := *ctx
+	newCtx.ignoreTenant = true
+	return &newCtx
+}
+
+// 注册多租户插件, field为模型中的租户字段名
+// Context设置了租户id且模型含有该字段时, 查询、更新、删除附加租户条件, 创建时写入租户id,
+// upsert冲突时只更新同一租户的数据
+func RegisterTenancy(callbacks *Callbacks, field string) error {
+	scope := func(params *CallbackParams) error {
+		if tenant, ok := tenancyValue(params, field); ok {
+			params.Model.builder.AddScope(field, tenant)
+		}
+		return nil
+	}
+	if err := callbacks.On(EventQueryBefore).Register(tenancyQuery, scope); err != nil {
+		return err
+	}
+	if err := callbacks.On(EventDeleteBefore).Register(tenancyDelete, scope); err != nil {
+		return err
+	}
+	if err := callbacks.On(EventUpdateBefore).Register(tenancyUpdate, func(params *CallbackParams) error {
+		tenant, ok := tenancyValue(params, field)
+		if !ok {
+			return nil
+		}
+		params.Model.builder.AddScope(field, tenant)
+		// 更新时保持租户字段不变
+		if params.Action == "update" {
+			return params.Model.schema.SetFieldValue(field, tenant)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	return callbacks.On(EventInsertBefore).Register(tenancyInsert, func(params *CallbackParams) error {
+		tenant, ok := tenancyValue(params, field)
+		if !ok {
+			return nil
+		}
+		// upsert冲突行属于其它租户时不更新, 租户字段本身不更新
+		if upsert := params.Model.builder.upsert; upsert != nil {
+			upsert.guard = field
+		}
+		return params.Model.schema.SetFieldValue(field, tenant)
+	})
+}
+
+// 当前操作需要使用的租户id
+func tenancyValue(params *CallbackParams, field string) (interface{}, bool) {
+	ctx := params.Context
+	if ctx == nil || ctx.tenant == nil || ctx.ignoreTenant || params.Model == nil {
+		return nil, false
+	}
+	if params.Model.schema.FieldNames[field] == nil {
+		return nil, false
+	}
+	return ctx.tenant, true
+}
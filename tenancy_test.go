@@ -0,0 +1,92 @@
+package korm
+
+import (
+	"database/sql/driver"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type TestTenantUser struct {
+	Id       int64            `db:"id"`
+	TenantId int64            `db:"tenant_id"`
+	Name     string           `db:"name"`
+	Items    []TestTenantItem `pk:"Id" fk:"UserId"`
+}
+
+type TestTenantItem struct {
+	Id       int64 `db:"id"`
+	UserId   int64 `db:"user_id"`
+	TenantId int64 `db:"tenant_id"`
+}
+
+// 注册多租户插件, 测试结束后移除
+func useTenancy(t *testing.T) {
+	callbacks := mainConnect.Callbacks()
+	assert.NoError(t, RegisterTenancy(callbacks, "TenantId"))
+	t.Cleanup(func() {
+		callbacks.On(EventQueryBefore).Remove(tenancyQuery)
+		callbacks.On(EventInsertBefore).Remove(tenancyInsert)
+		callbacks.On(EventUpdateBefore).Remove(tenancyUpdate)
+		callbacks.On(EventDeleteBefore).Remove(tenancyDelete)
+	})
+}
+
+// 测试按租户隔离数据
+func TestTenancy(t *testing.T) {
+	useTenancy(t)
+	table := setFakeTable("tenant", nil, nil)
+	table.pages = []fakePage{
+		{columns: []string{"id", "tenant_id", "name"}, rows: [][]driver.Value{{int64(1), int64(7), []byte("a")}}},
+		{columns: []string{"id", "user_id", "tenant_id"}, rows: [][]driver.Value{{int64(3), int64(1), int64(7)}}},
+	}
+	var rows []TestTenantUser
+	m := newFakeModel("tenant", &rows)
+	m.context.SetTenant(int64(7))
+	assert.NoError(t, m.With("Items").Where("Name", "a").Select().Error)
+	assert.Equal(t, "SELECT `id`,`tenant_id`,`name` FROM `test_tenant_user` WHERE (`name`=?) AND (`tenant_id`=?)", table.queries[0])
+	assert.Equal(t, "SELECT `id`,`user_id`,`tenant_id` FROM `test_tenant_item` WHERE (`user_id` in(?)) AND (`tenant_id`=?)", table.queries[1])
+	assert.Equal(t, []driver.Value{int64(1), int64(7)}, table.args[1])
+	assert.Len(t, rows[0].Items, 1)
+
+	row := &TestTenantUser{Name: "b", TenantId: 9}
+	ctx := UseContext("tenant").SetTenant(int64(7))
+	assert.NoError(t, ctx.Model(row).Create())
+	assert.Equal(t, int64(7), row.TenantId)
+	assert.Equal(t, int64(7), table.args[2][0])
+
+	row.TenantId = 9
+	assert.NoError(t, ctx.Model(row).Update())
+	assert.Equal(t, "UPDATE `test_tenant_user` SET `tenant_id`=?,`name`=? WHERE (`id`=?) AND (`tenant_id`=?)", table.queries[3])
+	assert.Equal(t, []driver.Value{int64(7), "b", int64(1), int64(7)}, table.args[3])
+
+	assert.NoError(t, ctx.IgnoreTenant().Model(row).Delete())
+	assert.Equal(t, "DELETE FROM `test_tenant_user` WHERE `id`=?", table.queries[4])
+	assert.NotNil(t, ctx.Tenant())
+}
+
+// 测试两个租户的upsert在同一主键上冲突时不覆盖其它租户的数据
+func TestTenancyUpsert(t *testing.T) {
+	useTenancy(t)
+	table := setFakeTable("tenant_upsert", nil, nil)
+	newFakeModel("tenant_upsert", &TestTenantUser{})
+
+	first := &TestTenantUser{Id: 5, Name: "a"}
+	assert.NoError(t, UseContext("tenant_upsert").SetTenant(int64(7)).Model(first).Upsert())
+	assert.Equal(t, int64(7), first.TenantId)
+
+	// 另一租户写入相同主键, 数据库判断为冲突且未修改任何行
+	table.results = []int64{0}
+	second := &TestTenantUser{Id: 5, Name: "b"}
+	assert.NoError(t, UseContext("tenant_upsert").SetTenant(int64(8)).Model(second).Upsert())
+	assert.Equal(t, "INSERT INTO `test_tenant_user` (`id`,`tenant_id`,`name`) VALUES (?,?,?)"+
+		" ON DUPLICATE KEY UPDATE `id`=IF(`tenant_id`=VALUES(`tenant_id`),LAST_INSERT_ID(`id`),`id`),"+
+		"`name`=IF(`tenant_id`=VALUES(`tenant_id`),VALUES(`name`),`name`)", table.queries[1])
+	assert.Equal(t, []driver.Value{int64(5), int64(8), "b"}, table.args[1])
+	assert.Equal(t, int64(5), second.Id)
+	assert.Equal(t, table.queries[0], table.queries[1])
+
+	// 忽略租户时不限制更新
+	assert.NoError(t, UseContext("tenant_upsert").Model(&TestTenantUser{Id: 5, TenantId: 8, Name: "c"}).Upsert())
+	assert.Equal(t, "INSERT INTO `test_tenant_user` (`id`,`tenant_id`,`name`) VALUES (?,?,?)"+
+		" ON DUPLICATE KEY UPDATE `id`=LAST_INSERT_ID(`id`),`tenant_id`=VALUES(`tenant_id`),`name`=VALUES(`name`)", table.queries[2])
+}
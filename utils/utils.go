@@ -6,6 +6,7 @@ import (
 	"github.com/wdaglb/korm/mixins"
 	"log"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -99,18 +100,36 @@ func Case2Camel(name string) string {
 	return strings.Replace(name, " ", "", -1)
 }
 
+// 获取字段对应的列名, 优先级: korm标签column > db标签 > 字段名
 func GetColumnName(field reflect.StructField) string {
-	db := field.Tag.Get("db")
-	if db != "" {
-		return db
+	if col := ParseTagSetting(field.Tag.Get("korm"))["column"]; col != "" {
+		return col
 	}
-	db = field.Tag.Get("json")
-	if db != "" {
+	if db := field.Tag.Get("db"); db != "" {
 		return db
 	}
 	return field.Name
 }
 
+// 解析korm标签, 格式为`korm:"column:name;primaryKey;size:64"`, 键名不区分大小写
+func ParseTagSetting(str string) map[string]string {
+	settings := make(map[string]string)
+	for _, item := range strings.Split(str, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, ":", 2)
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		if len(kv) == 2 {
+			settings[key] = strings.TrimSpace(kv[1])
+		} else {
+			settings[key] = ""
+		}
+	}
+	return settings
+}
+
 func ParseFieldDb(reType reflect.Type, field string) (string, reflect.StructField) {
 	var (
 		p  reflect.StructField
@@ -126,7 +145,11 @@ func ParseFieldDb(reType reflect.Type, field string) (string, reflect.StructFiel
 // 解析字段名
 func ParseField(driver string, reType reflect.Type, field string, raw bool) string {
 	field, _ = ParseFieldDb(reType, field)
+	return QuoteColumn(driver, field, raw)
+}
 
+// 按驱动为列名加上引号
+func QuoteColumn(driver string, field string, raw bool) string {
 	switch driver {
 	case "mssql":
 		if raw {
@@ -291,8 +314,8 @@ func StructToMap(data interface{}) map[string]interface{} {
 	for i := 0; i < fieldNum; i++ {
 		typeof := typeOf.Field(i)
 		field := valueOf.Field(i)
-		if field.Kind() == reflect.Ptr {
-			dst[typeof.Name] = CallValue(field)
+		if field.Kind() == reflect.Ptr && field.IsNil() {
+			dst[typeof.Name] = nil
 		} else {
 			dst[typeof.Name] = field.Interface()
 		}
@@ -340,3 +363,29 @@ func InIntArray(dst []int, vt int) bool {
 	}
 	return false
 }
+
+// 切片或数组转为[]interface{}, 其它值作为单个元素
+func ToInterfaceSlice(data interface{}) []interface{} {
+	if list, ok := data.([]interface{}); ok {
+		return list
+	}
+	valueOf := reflect.ValueOf(data)
+	if valueOf.Kind() != reflect.Slice && valueOf.Kind() != reflect.Array {
+		return []interface{}{data}
+	}
+	list := make([]interface{}, 0, valueOf.Len())
+	for i := 0; i < valueOf.Len(); i++ {
+		list = append(list, valueOf.Index(i).Interface())
+	}
+	return list
+}
+
+// 按字母顺序返回map的键
+func SortedKeys(data map[string]interface{}) []string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,17 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// 测试结构体转map时指针字段的处理
+func TestStructToMapPointer(t *testing.T) {
+	age := int64(18)
+	data := StructToMap(&struct {
+		Name *string
+		Age  *int64
+	}{Age: &age})
+	assert.Nil(t, data["Name"])
+	assert.Equal(t, &age, data["Age"])
+}
@@ -16,6 +16,18 @@ type WhereCondition struct {
 	Field string
 	Operator string
 	Condition interface{}
+	raw bool // Field为原生sql, Condition为参数列表
+}
+
+// 复制条件到指定构造器
+func (t *Where) clone(builder *SqlBuilder) *Where {
+	if t == nil {
+		return nil
+	}
+	return &Where{
+		builder: builder,
+		list:    append([]WhereCondition{}, t.list...),
+	}
 }
 
 // 添加条件
@@ -39,6 +51,13 @@ func (t *Where) parseOperator(v WhereCondition) string {
 		return fmt.Sprintf("%s %s(%s)", v.Field, v.Operator, strings.Join(values, ","))
 	}
 
+	if v.raw {
+		for _, arg := range v.Condition.([]interface{}) {
+			t.builder.bindParam(arg)
+		}
+		return fmt.Sprintf("(%s)", v.Field)
+	}
+
 	t.builder.bindParam(v.Condition)
 	return fmt.Sprintf("%s%s?", v.Field, v.Operator)
 }